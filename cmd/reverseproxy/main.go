@@ -1,26 +1,44 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/signal"
+	"reflect"
+	"regexp"
 	"syscall"
 	"time"
 
+	"reverseproxy/internal/accesslog"
 	"reverseproxy/internal/config"
 	masks "reverseproxy/internal/masker"
+	"reverseproxy/internal/tracing"
 	"reverseproxy/proxy"
 
+	"github.com/BurntSushi/toml"
 	"github.com/rs/zerolog"
 )
 
 var (
 	tomlPathFlag = flag.String("config", "./internal/config/example_config.toml",
-		"Specify the path of config.toml file, e.g.: -config /folder/config.toml")
+		"Specify the path of the config file (.toml, .yaml or .json), e.g.: -config /folder/config.toml")
+	watchIntervalFlag = flag.Duration("watch-interval", 2*time.Second,
+		"Interval to check the config file for changes, 0 disables it. SIGHUP always reloads it")
+	checkFlag = flag.Bool("check", false,
+		"Validate the config file, print the effective config and exit, e.g.: -check -config /folder/config.toml")
 )
 
 func main() {
 	flag.Parse()
+	if *checkFlag {
+		os.Exit(checkConfig(*tomlPathFlag))
+	}
 	// init logger
 	zerolog.DurationFieldInteger = true
 	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
@@ -30,39 +48,150 @@ func main() {
 		log.Panic().Err(err).Msg("failed to load config")
 	}
 	// Create Blockers from config
-	blockers := addBlockersFromConfig(cfg)
-	// Create Masker
-	masker := []proxy.Masker{
-		masks.NewEmailMasker(),
-		masks.NewCreditCardMasker()}
+	blockers, err := addBlockersFromConfig(cfg)
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to create blockers")
+	}
+	// Create Maskers from config
+	masker, maskerTypes, err := addMaskersFromConfig(cfg)
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to create maskers")
+	}
+	opts, err := optionsFromConfig(cfg, masker, maskerTypes)
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to create proxy options")
+	}
 	// Create Proxy
 	rp, err := proxy.New(
 		cfg.TargetURL,
 		cfg.ReverseProxyPort,
 		masker,
 		blockers,
-		log)
+		log,
+		opts...)
 	if err != nil {
 		log.Panic().Err(err).Msg("failed to create reverse proxy")
 	}
-	// bind signals to quit channel
+	if cfg.TLS != nil {
+		if rp.TLSConfig, err = tlsFromConfig(cfg.TLS); err != nil {
+			log.Panic().Err(err).Msg("failed to load TLS config")
+		}
+	}
+	if cfg.AccessLog != nil {
+		accessLog, out, err := accessLogFromConfig(cfg.AccessLog)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to open access log")
+		}
+		defer out.Close()
+		rp.AccessLog = accessLog
+	}
+	if cfg.Tracing != nil {
+		rp.Tracer = tracerFromConfig(cfg.Tracing, log)
+	}
+	// bind signals to quit and reload channels
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	stopWatch := make(chan struct{})
+	var changed <-chan struct{}
+	if *watchIntervalFlag > 0 {
+		changed = config.Watch(*tomlPathFlag, *watchIntervalFlag, stopWatch)
+	}
 	// Start it
 	cancel, err := rp.Start()
 	if err != nil {
 		log.Panic().Err(err).Msg("failed to start reverse proxy")
 	}
 	log.Info().Msg("reverse proxy started")
-	// Wait for quit signal
-	<-quit
+	// Reload config until quit signal
+	for running := true; running; {
+		select {
+		case <-quit:
+			running = false
+		case <-hup:
+			cfg = reloadConfig(log, rp, cfg)
+		case <-changed:
+			cfg = reloadConfig(log, rp, cfg)
+		}
+	}
+	close(stopWatch)
 	// Gracefully shutdown reverse proxy
 	cancel()
 	time.Sleep(time.Second * 1)
+	if rp.Tracer != nil {
+		ctx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := rp.Tracer.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to export the remaining spans")
+		}
+		cancelShutdown()
+	}
 	log.Info().Msg("reverse proxy stopped")
 }
 
-func addBlockersFromConfig(cfg *config.Config) []proxy.Blocker {
+// checkConfig validates the config file and prints the effective config without its secrets,
+// returns the exit code
+func checkConfig(path string) int {
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfg.RedactSecrets()
+	if err := toml.NewEncoder(os.Stdout).Encode(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%s is valid\n", path)
+	return 0
+}
+
+// reloadConfig loads the config file again and swaps it in rp, returns the config in use
+func reloadConfig(log zerolog.Logger, rp *proxy.ReverseProxy, current *config.Config) *config.Config {
+	cfg, err := config.LoadConfig(*tomlPathFlag)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid config, keeping the current one")
+		return current
+	}
+	if cfg.ReverseProxyPort != current.ReverseProxyPort {
+		log.Warn().Int("port", current.ReverseProxyPort).Msg("ReverseProxyPort can not be reloaded, restart to apply it")
+	}
+	if !reflect.DeepEqual(cfg.TLS, current.TLS) {
+		log.Warn().Msg("TLS can not be reloaded, restart to apply it")
+	}
+	if !reflect.DeepEqual(cfg.AccessLog, current.AccessLog) {
+		log.Warn().Msg("AccessLog can not be reloaded, restart to apply it")
+	}
+	if !reflect.DeepEqual(cfg.Tracing, current.Tracing) {
+		log.Warn().Msg("Tracing can not be reloaded, restart to apply it")
+	}
+	blockers, err := addBlockersFromConfig(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create blockers, keeping the current config")
+		return current
+	}
+	maskers, maskerTypes, err := addMaskersFromConfig(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create maskers, keeping the current config")
+		return current
+	}
+	opts, err := optionsFromConfig(cfg, maskers, maskerTypes)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create proxy options, keeping the current config")
+		return current
+	}
+	err = rp.Reload(cfg.TargetURL, maskers, blockers, opts...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to reload config, keeping the current one")
+		return current
+	}
+	for _, change := range config.Diff(current, cfg) {
+		log.Info().Str("change", change).Msg("config reloaded")
+	}
+	return cfg
+}
+
+func addBlockersFromConfig(cfg *config.Config) ([]proxy.Blocker, error) {
 	var blockers []proxy.Blocker
 	if cfg.HeaderBlocker != nil {
 		blockers = append(blockers, cfg.HeaderBlocker)
@@ -76,5 +205,326 @@ func addBlockersFromConfig(cfg *config.Config) []proxy.Blocker {
 	if cfg.MethodBlocker != nil {
 		blockers = append(blockers, cfg.MethodBlocker)
 	}
-	return blockers
+	if cfg.BodyBlocker != nil {
+		blockers = append(blockers, cfg.BodyBlocker)
+	}
+	if cfg.Plugins != nil {
+		for _, p := range cfg.Plugins.Blockers {
+			b, err := proxy.NewBlocker(p.Type, p.Options)
+			if err != nil {
+				return nil, err
+			}
+			blockers = append(blockers, b)
+		}
+	}
+	return blockers, nil
+}
+
+// addMaskersFromConfig returns the masker chain and the type of each masker
+func addMaskersFromConfig(cfg *config.Config) ([]proxy.Masker, []string, error) {
+	maskersCfg := cfg.Maskers
+	if maskersCfg == nil {
+		maskersCfg = &config.MaskersConfig{}
+	}
+	available := map[string]proxy.Masker{
+		config.EmailMaskerName:       masks.NewEmailMasker(),
+		config.CreditCardMaskerName:  masks.NewCreditCardMasker(),
+		config.PhoneMaskerName:       masks.NewPhoneMasker(),
+		config.IBANMaskerName:        masks.NewIBANMasker(),
+		config.SSNMaskerName:         masks.NewSSNMasker(),
+		config.ArgentineIDMaskerName: masks.NewArgentineIDMasker(),
+		config.IPMaskerName:          masks.NewIPMasker(),
+		config.SecretMaskerName:      masks.NewSecretMasker(),
+	}
+	if maskersCfg.Email != nil {
+		available[config.EmailMaskerName] = maskersCfg.Email
+	}
+	if maskersCfg.CreditCard != nil {
+		available[config.CreditCardMaskerName] = maskersCfg.CreditCard
+	}
+	order := maskersCfg.Order
+	if len(order) == 0 {
+		order = config.DefaultMaskersOrder
+	}
+	var maskers []proxy.Masker
+	var types []string
+	for _, name := range order {
+		maskers = append(maskers, available[name])
+		types = append(types, name)
+	}
+	if cfg.Plugins != nil {
+		for _, p := range cfg.Plugins.Maskers {
+			m, err := proxy.NewMasker(p.Type, p.Options)
+			if err != nil {
+				return nil, nil, err
+			}
+			maskers = append(maskers, m)
+			types = append(types, p.Type)
+		}
+	}
+	if t := maskersCfg.Tokenization; t != nil {
+		tokenizer, err := tokenizerFromConfig(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, m := range maskers {
+			if tm, ok := m.(interface{ SetTokenizer(masks.Tokenizer) }); ok {
+				tm.SetTokenizer(tokenizer)
+			}
+		}
+	}
+	return maskers, types, nil
 }
+
+// vaults are opened once and kept across reloads with their first limits, keyed by path, "" is the
+// memory vault
+var vaults = map[string]masks.Vault{}
+
+func tokenizerFromConfig(t *config.TokenizationConfig) (masks.Tokenizer, error) {
+	if t.Mode != config.TokenizationVault {
+		return masks.NewHMACTokenizer(t.Secret, t.Length), nil
+	}
+	vault, ok := vaults[t.VaultPath]
+	if !ok {
+		limits := masks.VaultLimits{MaxEntries: t.VaultMaxEntries}
+		if t.VaultTTL != "" {
+			ttl, err := time.ParseDuration(t.VaultTTL)
+			if err != nil {
+				return nil, err
+			}
+			limits.TTL = ttl
+		}
+		if t.Vault == config.VaultFile {
+			fv, err := masks.OpenFileVault(t.VaultPath, limits)
+			if err != nil {
+				return nil, err
+			}
+			vault = fv
+		} else {
+			vault = masks.NewMemoryVault(limits)
+		}
+		vaults[t.VaultPath] = vault
+	}
+	return masks.NewVaultTokenizer(t.Secret, t.Length, vault), nil
+}
+
+func optionsFromConfig(cfg *config.Config, maskers []proxy.Masker, maskerTypes []string) ([]proxy.Option, error) {
+	var opts []proxy.Option
+	if cfg.RequestIDHeader != "" {
+		opts = append(opts, proxy.WithRequestIDHeader(cfg.RequestIDHeader))
+	}
+	if cfg.Forwarding != nil {
+		forwarding, err := forwardingFromConfig(cfg.Forwarding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, proxy.WithForwarding(forwarding))
+	}
+	if len(cfg.HeaderRules) > 0 {
+		opts = append(opts, proxy.WithHeaderRules(cfg.HeaderRules...))
+	}
+	if len(cfg.RewriteRules) > 0 {
+		rules, err := rewriteRulesFromConfig(cfg.RewriteRules)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, proxy.WithRewriteRules(rules...))
+	}
+	if cfg.WebSocket != nil {
+		opts = append(opts, proxy.WithWebSocketMasking(cfg.WebSocket.MaskText))
+	}
+	if cfg.Streaming != nil {
+		streaming, err := streamingFromConfig(cfg.Streaming)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, proxy.WithStreaming(streaming))
+	}
+	if len(cfg.Policies) > 0 {
+		policies, err := policiesFromConfig(cfg.Policies, maskers, maskerTypes)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, proxy.WithPolicies(policies...))
+	}
+	if cfg.Maskers != nil && cfg.Maskers.Tokenization != nil && cfg.Maskers.Tokenization.DetokenizePath != "" {
+		t := cfg.Maskers.Tokenization
+		tokenizer, err := tokenizerFromConfig(t)
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := tokenizer.(proxy.Detokenizer); ok {
+			opts = append(opts, proxy.WithDetokenization(t.DetokenizePath, d, t.DetokenizeAPIKeys))
+		}
+	}
+	return opts, nil
+}
+
+// forwardingFromConfig sets the X-Forwarded headers when Headers is not set
+func forwardingFromConfig(cfg *config.ForwardingConfig) (proxy.Forwarding, error) {
+	f := proxy.Forwarding{Headers: cfg.Headers, Via: cfg.Via, PreserveHost: cfg.PreserveHost}
+	if f.Headers == nil {
+		f.Headers = proxy.DefaultForwarding.Headers
+	}
+	for _, cidr := range cfg.TrustedProxies {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return proxy.Forwarding{}, err
+		}
+		f.TrustedProxies = append(f.TrustedProxies, n)
+	}
+	return f, nil
+}
+
+// streamingFromConfig streams the default content types when ContentTypes is not set
+func streamingFromConfig(cfg *config.StreamingConfig) (proxy.Streaming, error) {
+	s := proxy.Streaming{ContentTypes: cfg.ContentTypes}
+	if s.ContentTypes == nil {
+		s.ContentTypes = proxy.DefaultStreaming.ContentTypes
+	}
+	if cfg.FlushInterval != "" {
+		interval, err := time.ParseDuration(cfg.FlushInterval)
+		if err != nil {
+			return proxy.Streaming{}, err
+		}
+		s.FlushInterval = interval
+	}
+	return s, nil
+}
+
+// rewriteRulesFromConfig compiles the patterns of the rules
+func rewriteRulesFromConfig(cfgs []config.RewriteRuleConfig) ([]proxy.RewriteRule, error) {
+	rules := make([]proxy.RewriteRule, 0, len(cfgs))
+	for _, c := range cfgs {
+		pattern, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, proxy.RewriteRule{
+			Pattern:        pattern,
+			Replacement:    c.Replacement,
+			AddQuery:       c.AddQuery,
+			RemoveQuery:    c.RemoveQuery,
+			RedirectStatus: c.Redirect,
+			Last:           c.Last,
+		})
+	}
+	return rules, nil
+}
+
+// policiesFromConfig builds the policies with the maskers of the chain of the types they list
+func policiesFromConfig(cfgs []config.PolicyConfig, maskers []proxy.Masker, maskerTypes []string) ([]proxy.Policy, error) {
+	policies := make([]proxy.Policy, 0, len(cfgs))
+	for _, c := range cfgs {
+		p := proxy.Policy{
+			Name:         c.Name,
+			Headers:      c.Match.Headers,
+			ClientNames:  c.Match.ClientNames,
+			PathPrefixes: c.Match.PathPrefixes,
+		}
+		for _, cidr := range c.Match.SourceCIDRs {
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			p.SourceCIDRs = append(p.SourceCIDRs, n)
+		}
+		for i, m := range maskers {
+			for _, t := range c.Maskers {
+				if maskerTypes[i] == t {
+					p.Maskers = append(p.Maskers, m)
+					break
+				}
+			}
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func tlsFromConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = x509.NewCertPool()
+		if !tlsCfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+		}
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsCfg, nil
+}
+
+// accessLogFromConfig creates the access logger and opens its output, which must be closed
+func accessLogFromConfig(cfg *config.AccessLogConfig) (*accesslog.Logger, io.Closer, error) {
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = zerolog.ParseLevel(cfg.Level); err != nil {
+			return nil, nil, err
+		}
+	}
+	var out io.WriteCloser
+	switch cfg.Output {
+	case config.AccessLogFile:
+		rf, err := accesslog.OpenRotatingFile(cfg.Path, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = rf
+	case config.AccessLogSyslog:
+		tag := cfg.SyslogTag
+		if tag == "" {
+			tag = "reverseproxy"
+		}
+		w, err := accesslog.OpenSyslog(cfg.SyslogSocket, tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = w
+	default:
+		out = nopCloser{os.Stdout}
+	}
+	format := cfg.Format
+	if format == "" {
+		format = accesslog.FormatJSON
+	}
+	al := accesslog.New(format, cfg.Fields, level, out)
+	if cfg.RedactHeaders != nil {
+		al.Redaction.Headers = cfg.RedactHeaders
+	}
+	al.Redaction.Bodies = cfg.LogBodies
+	if cfg.MaxBodyBytes > 0 {
+		al.Redaction.MaxBodyBytes = cfg.MaxBodyBytes
+	}
+	if len(cfg.BodyContentTypes) > 0 {
+		al.Redaction.ContentTypes = cfg.BodyContentTypes
+	}
+	return al, out, nil
+}
+
+// tracerFromConfig creates a tracer exporting to the OTLP collector of cfg
+func tracerFromConfig(cfg *config.TracingConfig, log zerolog.Logger) *tracing.Tracer {
+	service := cfg.ServiceName
+	if service == "" {
+		service = "reverseproxy"
+	}
+	return tracing.NewTracer(tracing.NewOTLPExporter(cfg.Endpoint, service, cfg.Headers), log)
+}
+
+// nopCloser keeps stdout open when the access log is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
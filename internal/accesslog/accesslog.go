@@ -0,0 +1,251 @@
+// Package accesslog writes an entry for every request served by the proxy, as JSON or in the
+// Common and Combined Log Formats.
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Formats of the entries
+const (
+	FormatJSON     = "json"
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+)
+
+// Fields of the JSON format
+const (
+	FieldTime            = "time"
+	FieldDuration        = "duration_ms"
+	FieldStatus          = "status"
+	FieldBytes           = "bytes"
+	FieldBytesReceived   = "bytes_received"
+	FieldMethod          = "method"
+	FieldPath            = "path"
+	FieldQuery           = "query"
+	FieldProto           = "proto"
+	FieldHost            = "host"
+	FieldRemoteAddr      = "remote_addr"
+	FieldUserAgent       = "user_agent"
+	FieldReferer         = "referer"
+	FieldRequestID       = "request_id"
+	FieldRequestHeaders  = "request_headers"
+	FieldResponseHeaders = "response_headers"
+	FieldRequestBody     = "request_body"
+	FieldResponseBody    = "response_body"
+)
+
+// Fields are every field of the JSON format
+var Fields = []string{FieldTime, FieldDuration, FieldStatus, FieldBytes, FieldBytesReceived, FieldMethod,
+	FieldPath, FieldQuery, FieldProto, FieldHost, FieldRemoteAddr, FieldUserAgent, FieldReferer, FieldRequestID,
+	FieldRequestHeaders, FieldResponseHeaders, FieldRequestBody, FieldResponseBody}
+
+// DefaultFields are the fields of the JSON format when none are configured
+var DefaultFields = []string{FieldTime, FieldDuration, FieldStatus, FieldBytes, FieldMethod, FieldPath,
+	FieldHost, FieldRemoteAddr, FieldUserAgent, FieldRequestID}
+
+// Entry is what is logged about a request
+type Entry struct {
+	// Time is when the request was received
+	Time time.Time
+	// Duration lasts until the response is sent, or the upgraded connection is closed
+	Duration time.Duration
+	Status   int
+	// Bytes is the size of the response body, or of what was sent on the upgraded connection
+	Bytes int64
+	// BytesReceived is the size of the request body, or of what was received on the upgraded connection
+	BytesReceived int64
+	Method        string
+	Path          string
+	Query         string
+	Proto         string
+	Host          string
+	RemoteAddr    string
+	UserAgent     string
+	Referer       string
+	RequestID     string
+
+	RequestHeaders  http.Header
+	ResponseHeaders http.Header
+	RequestBody     []byte
+	ResponseBody    []byte
+}
+
+// Logger writes entries in a format. Entries are logged at info level, warn for 4xx and error
+// for 5xx statuses, and the ones below the logger level are dropped.
+type Logger struct {
+	// Redaction is applied to the entries before they are written, DefaultRedaction by default.
+	// It must not be changed once the logger is in use
+	Redaction Redaction
+
+	format string
+	fields []string
+	level  zerolog.Level
+	log    zerolog.Logger
+	out    io.Writer
+}
+
+// New creates a logger writing entries in format to out, fields select the fields of the JSON format
+func New(format string, fields []string, level zerolog.Level, out io.Writer) *Logger {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	return &Logger{
+		Redaction: DefaultRedaction(),
+		format:    format,
+		fields:    fields,
+		level:     level,
+		log:       zerolog.New(out),
+		out:       out,
+	}
+}
+
+// FromLogger creates a JSON logger writing entries through log, which adds its own timestamp
+func FromLogger(log zerolog.Logger) *Logger {
+	return &Logger{
+		Redaction: DefaultRedaction(),
+		format:    FormatJSON,
+		fields:    DefaultFields[1:],
+		level:     zerolog.InfoLevel,
+		log:       log,
+	}
+}
+
+// Log writes e after applying the redaction to it
+func (l *Logger) Log(ctx context.Context, e *Entry) {
+	if l.Redact(ctx, e) {
+		l.Write(e)
+	}
+}
+
+// Redact applies the redaction to e when it is logged, it reports whether e is logged at the level
+// of l. The entries redacted are written with Write.
+func (l *Logger) Redact(ctx context.Context, e *Entry) bool {
+	if entryLevel(e) < l.level {
+		return false
+	}
+	l.Redaction.redact(ctx, e)
+	return true
+}
+
+// entryLevel is the level of e, warn for client errors and error for server ones
+func entryLevel(e *Entry) zerolog.Level {
+	switch {
+	case e.Status >= 500:
+		return zerolog.ErrorLevel
+	case e.Status >= 400:
+		return zerolog.WarnLevel
+	}
+	return zerolog.InfoLevel
+}
+
+// Write writes e as it is, it must have been redacted by Redact
+func (l *Logger) Write(e *Entry) {
+	level := entryLevel(e)
+	if l.format == FormatCommon || l.format == FormatCombined {
+		l.out.Write(l.appendCLF(nil, e))
+		return
+	}
+	event := l.log.WithLevel(level)
+	for _, f := range l.fields {
+		switch f {
+		case FieldTime:
+			event.Time(f, e.Time)
+		case FieldDuration:
+			event.Dur(f, e.Duration)
+		case FieldStatus:
+			event.Int(f, e.Status)
+		case FieldBytes:
+			event.Int64(f, e.Bytes)
+		case FieldBytesReceived:
+			event.Int64(f, e.BytesReceived)
+		case FieldMethod:
+			event.Str(f, e.Method)
+		case FieldPath:
+			event.Str(f, e.Path)
+		case FieldQuery:
+			event.Str(f, e.Query)
+		case FieldProto:
+			event.Str(f, e.Proto)
+		case FieldHost:
+			event.Str(f, e.Host)
+		case FieldRemoteAddr:
+			event.Str(f, e.RemoteAddr)
+		case FieldUserAgent:
+			event.Str(f, e.UserAgent)
+		case FieldReferer:
+			event.Str(f, e.Referer)
+		case FieldRequestID:
+			event.Str(f, e.RequestID)
+		case FieldRequestHeaders:
+			event.Dict(f, headersDict(e.RequestHeaders))
+		case FieldResponseHeaders:
+			event.Dict(f, headersDict(e.ResponseHeaders))
+		case FieldRequestBody:
+			event.Bytes(f, e.RequestBody)
+		case FieldResponseBody:
+			event.Bytes(f, e.ResponseBody)
+		}
+	}
+	event.Msg("request received")
+}
+
+func headersDict(h http.Header) *zerolog.Event {
+	dict := zerolog.Dict()
+	for name, values := range h {
+		for _, value := range values {
+			dict.Str(name, value)
+		}
+	}
+	return dict
+}
+
+// clfTime is the time layout of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// appendCLF appends e in the Common Log Format, or the Combined one, to b
+func (l *Logger) appendCLF(b []byte, e *Entry) []byte {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+	b = append(b, orDash(host)...)
+	b = append(b, " - - ["...)
+	b = e.Time.AppendFormat(b, clfTime)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, fmt.Sprintf("%s %s %s", e.Method, uri, e.Proto))
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	if e.Bytes > 0 {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	} else {
+		b = append(b, '-')
+	}
+	if l.format == FormatCombined {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.Referer))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.UserAgent))
+	}
+	return append(b, '\n')
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"reverseproxy/internal/accesslog"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func entry(status int) *accesslog.Entry {
+	return &accesslog.Entry{
+		Time:           time.Date(2023, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		Duration:       42 * time.Millisecond,
+		Status:         status,
+		Bytes:          2326,
+		BytesReceived:  512,
+		Method:         http.MethodGet,
+		Path:           "/apache_pb.gif",
+		Query:          "a=1",
+		Proto:          "HTTP/1.1",
+		Host:           "example.com",
+		RemoteAddr:     "127.0.0.1:51234",
+		UserAgent:      "Mozilla/4.08",
+		Referer:        "http://www.example.com/start.html",
+		RequestID:      "4bf92f3577b34da6",
+		RequestHeaders: http.Header{"Accept": {"*/*"}},
+	}
+}
+
+func TestLogger_Log(t *testing.T) {
+	zerolog.DurationFieldInteger = true
+	tests := map[string]struct {
+		format   string
+		fields   []string
+		level    zerolog.Level
+		entry    *accesslog.Entry
+		expected string
+	}{
+		"JSONDefaultFields": {
+			format: accesslog.FormatJSON,
+			entry:  entry(http.StatusOK),
+			expected: `{"level":"info","time":"2023-10-10T13:55:36-07:00","duration_ms":42,"status":200,` +
+				`"bytes":2326,"method":"GET","path":"/apache_pb.gif","host":"example.com",` +
+				`"remote_addr":"127.0.0.1:51234","user_agent":"Mozilla/4.08","request_id":"4bf92f3577b34da6",` +
+				`"message":"request received"}` + "\n",
+		},
+		"JSONSelectedFields": {
+			format: accesslog.FormatJSON,
+			fields: []string{accesslog.FieldStatus, accesslog.FieldBytesReceived, accesslog.FieldQuery,
+				accesslog.FieldRequestHeaders},
+			entry: entry(http.StatusNotFound),
+			expected: `{"level":"warn","status":404,"bytes_received":512,"query":"a=1","request_headers":{"Accept":"*/*"},` +
+				`"message":"request received"}` + "\n",
+		},
+		"Common": {
+			format:   accesslog.FormatCommon,
+			entry:    entry(http.StatusOK),
+			expected: `127.0.0.1 - - [10/Oct/2023:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.1" 200 2326` + "\n",
+		},
+		"Combined": {
+			format: accesslog.FormatCombined,
+			entry:  entry(http.StatusOK),
+			expected: `127.0.0.1 - - [10/Oct/2023:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.1" 200 2326 ` +
+				`"http://www.example.com/start.html" "Mozilla/4.08"` + "\n",
+		},
+		"BelowLevel": {
+			format: accesslog.FormatCommon,
+			level:  zerolog.WarnLevel,
+			entry:  entry(http.StatusOK),
+		},
+		"ErrorAboveLevel": {
+			format:   accesslog.FormatCommon,
+			level:    zerolog.WarnLevel,
+			entry:    entry(http.StatusBadGateway),
+			expected: `127.0.0.1 - - [10/Oct/2023:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.1" 502 2326` + "\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			accesslog.New(tt.format, tt.fields, tt.level, &out).Log(context.TODO(), tt.entry)
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+}
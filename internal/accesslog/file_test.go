@@ -0,0 +1,50 @@
+package accesslog_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reverseproxy/internal/accesslog"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := accesslog.OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := rf.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, rf.Close())
+
+	files := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for file, expected := range files {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), file)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "only MaxBackups files are kept")
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("existing\n"), 0o640))
+	rf, err := accesslog.OpenRotatingFile(path, 0, 0)
+	require.NoError(t, err)
+	_, err = rf.Write([]byte(strings.Repeat("x", 100) + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, rf.Close())
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "existing\n"+strings.Repeat("x", 100)+"\n", string(content))
+}
@@ -0,0 +1,131 @@
+package accesslog
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Redacted replaces the values that can't be logged
+const Redacted = "[REDACTED]"
+
+// DefaultRedactHeaders are the headers whose values are never logged when none are configured
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "X-Auth-Token"}
+
+// DefaultMaxBodyBytes is the size of the bodies logged when none is configured
+const DefaultMaxBodyBytes = 4096
+
+// BodyLookahead is the size of the bodies captured beyond MaxBodyBytes, so the values cut by the
+// limit are masked whole before the bodies are truncated
+const BodyLookahead = 256
+
+// DefaultBodyContentTypes are the media types of the bodies logged when none are configured
+var DefaultBodyContentTypes = []string{"application/json", "application/xml", "application/x-www-form-urlencoded",
+	"text/"}
+
+// Redaction removes sensitive data from the entries before they are written.
+type Redaction struct {
+	// Headers are the names of the headers whose values are replaced
+	Headers []string
+	// Bodies logs the request and response bodies, they are dropped otherwise
+	Bodies bool
+	// MaxBodyBytes truncates the bodies logged
+	MaxBodyBytes int
+	// ContentTypes restricts the bodies logged to these media types, or prefixes ending in "/"
+	ContentTypes []string
+	// Mask is applied to every value logged from the request or the response: header values, path,
+	// query, referer and bodies
+	Mask func(ctx context.Context, text []byte) []byte
+}
+
+// DefaultRedaction denies the DefaultRedactHeaders and drops the bodies
+func DefaultRedaction() Redaction {
+	return Redaction{
+		Headers:      DefaultRedactHeaders,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+		ContentTypes: DefaultBodyContentTypes,
+	}
+}
+
+// CaptureBytes is the size of the bodies to capture for the entries, 0 when they are not logged
+func (r *Redaction) CaptureBytes() int {
+	if !r.Bodies {
+		return 0
+	}
+	return r.MaxBodyBytes + BodyLookahead
+}
+
+// redact applies the redaction to e
+func (r *Redaction) redact(ctx context.Context, e *Entry) {
+	e.RequestBody = r.body(ctx, e.RequestBody, e.RequestHeaders.Get("Content-Type"))
+	e.ResponseBody = r.body(ctx, e.ResponseBody, e.ResponseHeaders.Get("Content-Type"))
+	e.RequestHeaders = r.headers(ctx, e.RequestHeaders)
+	e.ResponseHeaders = r.headers(ctx, e.ResponseHeaders)
+	e.Path = r.mask(ctx, e.Path)
+	e.Query = r.mask(ctx, e.Query)
+	e.Referer = r.mask(ctx, e.Referer)
+}
+
+func (r *Redaction) body(ctx context.Context, body []byte, contentType string) []byte {
+	if !r.Bodies || len(body) == 0 || !r.logsContentType(contentType) {
+		return nil
+	}
+	// Masking first, a value cut by the limit would not be recognized
+	if r.Mask != nil {
+		body = r.Mask(ctx, body)
+	}
+	if len(body) > r.MaxBodyBytes {
+		body = body[:r.MaxBodyBytes]
+	}
+	return body
+}
+
+// headers returns a copy of h with the denied values replaced and the rest masked
+func (r *Redaction) headers(ctx context.Context, h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	denied := map[string]bool{}
+	for _, name := range r.Headers {
+		denied[http.CanonicalHeaderKey(name)] = true
+	}
+	redactedHeaders := make(http.Header, len(h))
+	for name, values := range h {
+		copied := make([]string, len(values))
+		for i, v := range values {
+			if denied[http.CanonicalHeaderKey(name)] {
+				copied[i] = Redacted
+			} else {
+				copied[i] = r.mask(ctx, v)
+			}
+		}
+		redactedHeaders[name] = copied
+	}
+	return redactedHeaders
+}
+
+func (r *Redaction) mask(ctx context.Context, s string) string {
+	if r.Mask == nil || s == "" {
+		return s
+	}
+	return string(r.Mask(ctx, []byte(s)))
+}
+
+func (r *Redaction) logsContentType(contentType string) bool {
+	if len(r.ContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, ct := range r.ContentTypes {
+		ct = strings.ToLower(ct)
+		if mediaType == ct || (strings.HasSuffix(ct, "/") && strings.HasPrefix(mediaType, ct)) {
+			return true
+		}
+	}
+	return false
+}
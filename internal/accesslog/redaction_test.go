@@ -0,0 +1,127 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"reverseproxy/internal/accesslog"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedaction(t *testing.T) {
+	upper := func(ctx context.Context, text []byte) []byte { return bytes.ToUpper(text) }
+	card, digit := regexp.MustCompile(`\d{4}( \d{4}){3}`), regexp.MustCompile(`\d`)
+	maskCards := func(ctx context.Context, text []byte) []byte {
+		return card.ReplaceAllFunc(text, func(m []byte) []byte { return digit.ReplaceAll(m, []byte("*")) })
+	}
+	tests := map[string]struct {
+		redaction func(r *accesslog.Redaction)
+		entry     *accesslog.Entry
+		expected  string
+	}{
+		"DefaultHeaders": {
+			entry: &accesslog.Entry{
+				Path: "/users",
+				RequestHeaders: http.Header{"Authorization": {"Bearer secret"}, "Cookie": {"a=1"},
+					"Accept": {"*/*"}},
+				ResponseHeaders: http.Header{"Set-Cookie": {"session=secret"}},
+				RequestBody:     []byte(`{"a":1}`),
+			},
+			expected: `{"level":"info","path":"/users","request_headers":{"Accept":"*/*","Authorization":"[REDACTED]",` +
+				`"Cookie":"[REDACTED]"},"response_headers":{"Set-Cookie":"[REDACTED]"},` +
+				`"request_body":"","response_body":"","message":"request received"}`,
+		},
+		"ConfiguredHeaders": {
+			redaction: func(r *accesslog.Redaction) { r.Headers = []string{"x-user"} },
+			entry: &accesslog.Entry{
+				Path:           "/users",
+				RequestHeaders: http.Header{"Authorization": {"Bearer secret"}, "X-User": {"alice"}},
+			},
+			expected: `{"level":"info","path":"/users","request_headers":{"Authorization":"Bearer secret","X-User":"[REDACTED]"},` +
+				`"response_headers":{},"request_body":"","response_body":"","message":"request received"}`,
+		},
+		"Bodies": {
+			redaction: func(r *accesslog.Redaction) { r.Bodies = true },
+			entry: &accesslog.Entry{
+				Path:            "/users",
+				RequestHeaders:  http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+				ResponseHeaders: http.Header{"Content-Type": {"text/plain"}},
+				RequestBody:     []byte(`{"a":1}`),
+				ResponseBody:    []byte("hello"),
+			},
+			expected: `{"level":"info","path":"/users","request_headers":{"Content-Type":"application/json; charset=utf-8"},` +
+				`"response_headers":{"Content-Type":"text/plain"},"request_body":"{\"a\":1}",` +
+				`"response_body":"hello","message":"request received"}`,
+		},
+		"BodyContentTypes": {
+			redaction: func(r *accesslog.Redaction) { r.Bodies = true },
+			entry: &accesslog.Entry{
+				Path:            "/image",
+				ResponseHeaders: http.Header{"Content-Type": {"image/png"}},
+				ResponseBody:    []byte("\x89PNG"),
+			},
+			expected: `{"level":"info","path":"/image","request_headers":{},"response_headers":{"Content-Type":"image/png"},` +
+				`"request_body":"","response_body":"","message":"request received"}`,
+		},
+		"MaxBodyBytes": {
+			redaction: func(r *accesslog.Redaction) {
+				r.Bodies = true
+				r.MaxBodyBytes = 4
+			},
+			entry: &accesslog.Entry{
+				Path:            "/users",
+				ResponseHeaders: http.Header{"Content-Type": {"text/plain"}},
+				ResponseBody:    []byte("hello"),
+			},
+			expected: `{"level":"info","path":"/users","request_headers":{},"response_headers":{"Content-Type":"text/plain"},` +
+				`"request_body":"","response_body":"hell","message":"request received"}`,
+		},
+		"MaskBeforeTruncate": {
+			redaction: func(r *accesslog.Redaction) {
+				r.Bodies = true
+				r.MaxBodyBytes = 24
+				r.Mask = maskCards
+			},
+			entry: &accesslog.Entry{
+				Path:            "/cards",
+				ResponseHeaders: http.Header{"Content-Type": {"application/json"}},
+				ResponseBody:    []byte(`{"card": "4012 8888 8888 1881"}`),
+			},
+			expected: `{"level":"info","path":"/cards","request_headers":{},"response_headers":{"Content-Type":"application/json"},` +
+				`"request_body":"","response_body":"{\"card\": \"**** **** ****","message":"request received"}`,
+		},
+		"Mask": {
+			redaction: func(r *accesslog.Redaction) {
+				r.Bodies = true
+				r.Mask = upper
+			},
+			entry: &accesslog.Entry{
+				Path:            "/users/alice",
+				RequestHeaders:  http.Header{"X-User": {"alice"}, "Cookie": {"secret"}},
+				ResponseHeaders: http.Header{"Content-Type": {"text/plain"}},
+				ResponseBody:    []byte("hello alice"),
+			},
+			expected: `{"level":"info","path":"/USERS/ALICE","request_headers":{"Cookie":"[REDACTED]",` +
+				`"X-User":"ALICE"},"response_headers":{"Content-Type":"TEXT/PLAIN"},"request_body":"","response_body":"HELLO ALICE",` +
+				`"message":"request received"}`,
+		},
+	}
+	fields := []string{accesslog.FieldPath, accesslog.FieldRequestHeaders,
+		accesslog.FieldResponseHeaders, accesslog.FieldRequestBody, accesslog.FieldResponseBody}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			log := accesslog.New(accesslog.FormatJSON, fields, zerolog.InfoLevel, &out)
+			if tt.redaction != nil {
+				tt.redaction(&log.Redaction)
+			}
+			log.Log(context.TODO(), tt.entry)
+			assert.JSONEq(t, tt.expected, out.String())
+		})
+	}
+}
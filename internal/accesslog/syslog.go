@@ -0,0 +1,21 @@
+//go:build !windows && !plan9
+
+package accesslog
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// OpenSyslog connects to the local syslog daemon, through socket when set, e.g. /dev/log
+func OpenSyslog(socket, tag string) (io.WriteCloser, error) {
+	priority := syslog.LOG_INFO | syslog.LOG_DAEMON
+	if socket == "" {
+		return syslog.New(priority, tag)
+	}
+	w, err := syslog.Dial("unixgram", socket, priority, tag)
+	if err != nil {
+		return syslog.Dial("unix", socket, priority, tag)
+	}
+	return w, nil
+}
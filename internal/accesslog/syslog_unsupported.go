@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package accesslog
+
+import (
+	"errors"
+	"io"
+)
+
+// OpenSyslog is not supported on this platform
+func OpenSyslog(socket, tag string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -5,8 +5,20 @@ import (
 	"net/http"
 )
 
+// Mode is embedded by every blocker to configure how its verdict is enforced.
+type Mode struct {
+	// Monitor evaluates and logs the blocker but never blocks the request.
+	Monitor bool
+}
+
+// MonitorOnly reports whether the blocker runs in monitor mode.
+func (m Mode) MonitorOnly() bool {
+	return m.Monitor
+}
+
 // HeaderBlocker ...
 type HeaderBlocker struct {
+	Mode
 	HeaderMap map[string]string
 }
 
@@ -27,6 +39,7 @@ func (hb *HeaderBlocker) Name() string {
 
 // MethodBlocker ...
 type MethodBlocker struct {
+	Mode
 	Method []string
 }
 
@@ -47,6 +60,7 @@ func (mb *MethodBlocker) Name() string {
 
 // PathBlocker ...
 type PathBlocker struct {
+	Mode
 	Path []string
 }
 
@@ -67,6 +81,7 @@ func (pb *PathBlocker) Name() string {
 
 // QueryParamBlocker ...
 type QueryParamBlocker struct {
+	Mode
 	ParamsMap map[string]string
 }
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"reverseproxy/internal/blocker"
+	"reverseproxy/proxy"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -198,3 +199,22 @@ func TestQueryParamBlocker_Name(t *testing.T) {
 		t.Errorf("Expected name to be \"Query Param Blocker\", but got %v", b.Name())
 	}
 }
+
+func TestRegistry(t *testing.T) {
+	b, err := proxy.NewBlocker(blocker.HeaderType, map[string]interface{}{
+		"HeaderMap": map[string]interface{}{"X-Blocker": "Block"},
+		"Monitor":   true,
+	})
+	require.NoError(t, err)
+	expected := &blocker.HeaderBlocker{
+		Mode:      blocker.Mode{Monitor: true},
+		HeaderMap: map[string]string{"X-Blocker": "Block"},
+	}
+	assert.Equal(t, expected, b)
+	_, err = proxy.NewBlocker(blocker.BodyType, map[string]interface{}{"Signatures": []string{"unknown"}})
+	assert.Error(t, err)
+	for _, typeName := range []string{blocker.QueryParamType, blocker.PathType, blocker.MethodType} {
+		_, err := proxy.NewBlocker(typeName, nil)
+		assert.NoError(t, err)
+	}
+}
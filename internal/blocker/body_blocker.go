@@ -0,0 +1,226 @@
+package blocker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// defaultMaxBodyBytes is the amount of request body inspected when MaxBodyBytes is not set.
+const defaultMaxBodyBytes = 64 << 10
+
+// Severity of a body signature.
+type Severity int
+
+// Signature severities, ordered from least to most severe.
+const (
+	SeverityLow Severity = iota + 1
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = map[Severity]string{
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// String returns the severity name.
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return "unset"
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity name, e.g. "high".
+func (s *Severity) UnmarshalText(text []byte) error {
+	for sev, name := range severityNames {
+		if strings.EqualFold(string(text), name) {
+			*s = sev
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Signature is a named pattern matched against the request body.
+type Signature struct {
+	Name     string
+	Pattern  string
+	Severity Severity
+}
+
+// builtinSignatures are the signature sets that can be enabled by name.
+var builtinSignatures = map[string][]Signature{
+	"sqli": {
+		{Name: "sqli-union-select", Pattern: `(?i)\bunion\b[\s\S]{0,20}\bselect\b`, Severity: SeverityHigh},
+		{Name: "sqli-tautology", Pattern: `(?i)['"]\s*(?:or|and)\s+['"]?\w+['"]?\s*=\s*['"]?\w+`, Severity: SeverityHigh},
+		{Name: "sqli-ddl", Pattern: `(?i)\b(?:drop|truncate|alter)\s+table\b`, Severity: SeverityCritical},
+		{Name: "sqli-stacked-exec", Pattern: `(?i);\s*(?:shutdown|exec(?:ute)?\s+xp_)`, Severity: SeverityCritical},
+		{Name: "sqli-time-based", Pattern: `(?i)\b(?:sleep|benchmark|pg_sleep)\s*\(`, Severity: SeverityMedium},
+	},
+	"xss": {
+		{Name: "xss-script-tag", Pattern: `(?i)<\s*script[\s>/]`, Severity: SeverityHigh},
+		{Name: "xss-javascript-uri", Pattern: `(?i)\bjavascript\s*:`, Severity: SeverityMedium},
+		{Name: "xss-event-handler", Pattern: `(?i)\bon(?:error|load|click|mouseover|focus)\s*=`, Severity: SeverityMedium},
+		{Name: "xss-iframe-tag", Pattern: `(?i)<\s*iframe[\s>/]`, Severity: SeverityMedium},
+	},
+	"path_traversal": {
+		{Name: "path-traversal-dot-dot", Pattern: `(?i)(?:\.\.|%2e%2e)(?:/|\\|%2f|%5c)`, Severity: SeverityMedium},
+		{Name: "path-traversal-sensitive-file", Pattern: `(?i)/etc/(?:passwd|shadow)|\b(?:win|boot)\.ini\b`, Severity: SeverityHigh},
+	},
+}
+
+type compiledSignature struct {
+	Signature
+	re *regexp.Regexp
+}
+
+// BodyBlocker inspects up to MaxBodyBytes of the request body and blocks requests matching
+// any of the enabled signatures with at least MinSeverity.
+// Signatures selects built-in sets ("sqli", "xss", "path_traversal"), all of them if empty.
+type BodyBlocker struct {
+	Mode
+	MaxBodyBytes     int64
+	Signatures       []string
+	CustomSignatures []Signature
+	MinSeverity      Severity
+
+	once     sync.Once
+	compiled []compiledSignature
+	err      error
+}
+
+// Compile validates and compiles the signatures, it is called lazily by Block.
+func (bb *BodyBlocker) Compile() error {
+	bb.once.Do(func() {
+		sets := bb.Signatures
+		if len(sets) == 0 {
+			sets = []string{"sqli", "xss", "path_traversal"}
+		}
+		var signatures []Signature
+		for _, name := range sets {
+			set, ok := builtinSignatures[name]
+			if !ok {
+				bb.err = fmt.Errorf("unknown signature set %q", name)
+				return
+			}
+			signatures = append(signatures, set...)
+		}
+		signatures = append(signatures, bb.CustomSignatures...)
+		for _, s := range signatures {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				bb.err = fmt.Errorf("signature %q: %w", s.Name, err)
+				return
+			}
+			if s.Severity == 0 {
+				s.Severity = SeverityMedium
+			}
+			bb.compiled = append(bb.compiled, compiledSignature{Signature: s, re: re})
+		}
+	})
+	return bb.err
+}
+
+// Block every request whose body matches a signature, the body is restored for the upstream.
+func (bb *BodyBlocker) Block(ctx context.Context, r *http.Request) (bool, error) {
+	if err := bb.Compile(); err != nil {
+		return false, err
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return false, nil
+	}
+	limit := bb.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit))
+	// Put back what we read in front of the rest of the body, a monitored blocker failing to
+	// read it lets the request through
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return false, err
+	}
+
+	candidates := [][]byte{body}
+	if decoded := unescape(body); decoded != nil {
+		candidates = append(candidates, decoded)
+	}
+	log := zerolog.Ctx(ctx)
+	for _, s := range bb.compiled {
+		if s.Severity < bb.MinSeverity {
+			continue
+		}
+		for _, c := range candidates {
+			if !s.re.Match(c) {
+				continue
+			}
+			log.Info().Str("signature", s.Name).Str("severity", s.Severity.String()).
+				Msg("body signature matched")
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Name returns the name of the blocker.
+func (bb *BodyBlocker) Name() string {
+	return "Body Blocker"
+}
+
+// unescape decodes the %XX escapes and the + of a URL-encoded body, the invalid escapes are kept as
+// they are so they can't hide the rest of the body. It returns nil when there is nothing to decode.
+func unescape(body []byte) []byte {
+	if bytes.IndexByte(body, '%') < 0 && bytes.IndexByte(body, '+') < 0 {
+		return nil
+	}
+	decoded := make([]byte, 0, len(body))
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '%' && i+2 < len(body) && isHex(body[i+1]) && isHex(body[i+2]):
+			decoded = append(decoded, unhex(body[i+1])<<4|unhex(body[i+2]))
+			i += 2
+		case c == '+':
+			decoded = append(decoded, ' ')
+		default:
+			decoded = append(decoded, c)
+		}
+	}
+	return decoded
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c <= '9':
+		return c - '0'
+	case c <= 'F':
+		return c - 'A' + 10
+	default:
+		return c - 'a' + 10
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,130 @@
+package blocker_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"reverseproxy/internal/blocker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyBlocker_Block(t *testing.T) {
+	tests := map[string]struct {
+		blocker  *blocker.BodyBlocker
+		body     string
+		expected bool
+	}{
+		"SQLInjection": {
+			blocker:  &blocker.BodyBlocker{},
+			body:     `{"user": "admin' OR 1=1 --"}`,
+			expected: true,
+		},
+		"URLEncodedSQLInjection": {
+			blocker:  &blocker.BodyBlocker{},
+			body:     "q=1%20UNION%20SELECT%20password%20FROM%20users",
+			expected: true,
+		},
+		"URLEncodedWithInvalidEscape": {
+			blocker:  &blocker.BodyBlocker{},
+			body:     "%zz&q=%27%20OR%201%3D1",
+			expected: true,
+		},
+		"XSS": {
+			blocker:  &blocker.BodyBlocker{},
+			body:     `<script>alert(1)</script>`,
+			expected: true,
+		},
+		"PathTraversal": {
+			blocker:  &blocker.BodyBlocker{},
+			body:     `file=../../etc/passwd`,
+			expected: true,
+		},
+		"CleanBody": {
+			blocker:  &blocker.BodyBlocker{},
+			body:     `{"name": "John", "comment": "select your plan"}`,
+			expected: false,
+		},
+		"SignatureSetNotEnabled": {
+			blocker:  &blocker.BodyBlocker{Signatures: []string{"xss"}},
+			body:     `admin' OR 1=1`,
+			expected: false,
+		},
+		"BelowMinSeverity": {
+			blocker:  &blocker.BodyBlocker{MinSeverity: blocker.SeverityHigh},
+			body:     `javascript:alert(1)`,
+			expected: false,
+		},
+		"CustomSignature": {
+			blocker: &blocker.BodyBlocker{
+				Signatures: []string{"xss"},
+				CustomSignatures: []blocker.Signature{
+					{Name: "debug", Pattern: `__debug__=1`, Severity: blocker.SeverityLow},
+				},
+			},
+			body:     `a=1&__debug__=1`,
+			expected: true,
+		},
+		"MatchAfterMaxBodyBytes": {
+			blocker:  &blocker.BodyBlocker{MaxBodyBytes: 8},
+			body:     `01234567<script>`,
+			expected: false,
+		},
+		"Monitor": {
+			// The match is reported, the proxy doesn't enforce it
+			blocker:  &blocker.BodyBlocker{Mode: blocker.Mode{Monitor: true}},
+			body:     `<script>alert(1)</script>`,
+			expected: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			result, err := tt.blocker.Block(context.TODO(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+			// The body must be intact for the target server
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestBodyBlocker_InvalidSignature(t *testing.T) {
+	b := &blocker.BodyBlocker{
+		CustomSignatures: []blocker.Signature{{Name: "broken", Pattern: `(`}},
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://localhost", strings.NewReader("body"))
+	require.NoError(t, err)
+	_, err = b.Block(context.TODO(), req)
+	assert.Error(t, err)
+	assert.Error(t, (&blocker.BodyBlocker{Signatures: []string{"unknown"}}).Compile())
+}
+
+func TestBodyBlocker_ReadError(t *testing.T) {
+	b := &blocker.BodyBlocker{Mode: blocker.Mode{Monitor: true}}
+	body := io.MultiReader(strings.NewReader("a=1&b=2"), iotest.ErrReader(errors.New("read error")))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost", body)
+	require.NoError(t, err)
+	_, err = b.Block(context.TODO(), req)
+	assert.Error(t, err)
+	// The bytes read are forwarded before the error
+	read, err := io.ReadAll(req.Body)
+	assert.Error(t, err)
+	assert.Equal(t, "a=1&b=2", string(read))
+}
+
+func TestBodyBlocker_Name(t *testing.T) {
+	b := &blocker.BodyBlocker{}
+	if b.Name() != "Body Blocker" {
+		t.Errorf("Expected name to be \"Body Blocker\", but got %v", b.Name())
+	}
+}
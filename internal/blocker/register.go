@@ -0,0 +1,36 @@
+package blocker
+
+import "reverseproxy/proxy"
+
+// Types of the built-in blockers in the proxy registry
+const (
+	HeaderType     = "header"
+	QueryParamType = "param"
+	PathType       = "path"
+	MethodType     = "method"
+	BodyType       = "body"
+)
+
+func init() {
+	register(HeaderType, func() proxy.Blocker { return &HeaderBlocker{} })
+	register(QueryParamType, func() proxy.Blocker { return &QueryParamBlocker{} })
+	register(PathType, func() proxy.Blocker { return &PathBlocker{} })
+	register(MethodType, func() proxy.Blocker { return &MethodBlocker{} })
+	register(BodyType, func() proxy.Blocker { return &BodyBlocker{} })
+}
+
+// register a factory decoding the options into the blocker returned by newBlocker
+func register(typeName string, newBlocker func() proxy.Blocker) {
+	proxy.RegisterBlocker(typeName, func(options map[string]interface{}) (proxy.Blocker, error) {
+		b := newBlocker()
+		if err := proxy.DecodeOptions(options, b); err != nil {
+			return nil, err
+		}
+		if c, ok := b.(interface{ Compile() error }); ok {
+			if err := c.Compile(); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	})
+}
@@ -1,9 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"reverseproxy/internal/blocker"
+	"reverseproxy/internal/masker"
+	"reverseproxy/proxy"
 
 	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 // Config ...
@@ -14,14 +23,295 @@ type Config struct {
 	ParamBlocker     *blocker.QueryParamBlocker `toml:"ParamBlocker"`
 	PathBlocker      *blocker.PathBlocker       `toml:"PathBlocker"`
 	MethodBlocker    *blocker.MethodBlocker     `toml:"MethodBlocker"`
+	BodyBlocker      *blocker.BodyBlocker       `toml:"BodyBlocker"`
+	Maskers          *MaskersConfig             `toml:"Maskers"`
+	Plugins          *PluginsConfig             `toml:"Plugins"`
+	TLS              *TLSConfig                 `toml:"TLS"`
+	Policies         []PolicyConfig             `toml:"Policies"`
+	AccessLog        *AccessLogConfig           `toml:"AccessLog"`
+	// RequestIDHeader carries the request ID, X-Request-ID by default
+	RequestIDHeader string            `toml:"RequestIDHeader"`
+	Tracing         *TracingConfig    `toml:"Tracing"`
+	Forwarding      *ForwardingConfig `toml:"Forwarding"`
+	// HeaderRules change the headers of the requests and responses of their routes, in order
+	HeaderRules []proxy.HeaderRule `toml:"HeaderRules"`
+	// RewriteRules rewrite or redirect the requests whose path matches, in order
+	RewriteRules []RewriteRuleConfig `toml:"RewriteRules"`
+	WebSocket    *WebSocketConfig    `toml:"WebSocket"`
+	Streaming    *StreamingConfig    `toml:"Streaming"`
 }
 
-// LoadConfig from toml file
-func LoadConfig(tomlPath string) (*Config, error) {
-	conf := &Config{}
-	_, err := toml.DecodeFile(tomlPath, conf)
+// RewriteRuleConfig rewrites the path and the query of the requests whose path matches Pattern,
+// or redirects them.
+type RewriteRuleConfig struct {
+	// Pattern is a regexp matched against the path
+	Pattern string `toml:"Pattern"`
+	// Replacement replaces the path, with $1, $name or $${name} for the groups of Pattern. ${name}
+	// is an environment variable
+	Replacement string            `toml:"Replacement"`
+	AddQuery    map[string]string `toml:"AddQuery"`
+	RemoveQuery []string          `toml:"RemoveQuery"`
+	// Redirect responds with this redirect status instead of forwarding the request
+	Redirect int `toml:"Redirect"`
+	// Last stops the evaluation of the next rules
+	Last bool `toml:"Last"`
+}
+
+// ForwardingConfig controls the headers telling the target about the client, without it the
+// X-Forwarded headers are set and no peer is trusted.
+type ForwardingConfig struct {
+	// Headers are the headers set among X-Forwarded-For, X-Forwarded-Host, X-Forwarded-Proto,
+	// Forwarded and Via. The X-Forwarded headers when not set, none when empty
+	Headers []string `toml:"Headers"`
+	// Via is the name of the proxy in the Via header, reverseproxy by default
+	Via string `toml:"Via"`
+	// PreserveHost forwards the Host header of the client instead of the target host
+	PreserveHost bool `toml:"PreserveHost"`
+	// TrustedProxies are the CIDRs of the peers whose forwarding headers are kept and appended to,
+	// they are stripped from the requests of any other peer
+	TrustedProxies []string `toml:"TrustedProxies"`
+}
+
+// WebSocketConfig controls the WebSockets proxied to the target, their messages are passed through
+// unchanged without it
+type WebSocketConfig struct {
+	// MaskText masks the text messages sent by the target with the maskers of the request
+	MaskText bool `toml:"MaskText"`
+}
+
+// StreamingConfig controls the responses passed through as the target sends them, Server-Sent
+// Events and newline delimited JSON are streamed without it.
+type StreamingConfig struct {
+	// ContentTypes are the media types streamed and masked one event or line at a time. The
+	// default ones when not set, none when empty
+	ContentTypes []string `toml:"ContentTypes"`
+	// FlushInterval is how often the other responses are flushed while they are copied, e.g. "100ms".
+	// A negative interval flushes after every write
+	FlushInterval string `toml:"FlushInterval"`
+}
+
+// TracingConfig exports the spans of every request to an OTLP/HTTP collector
+type TracingConfig struct {
+	// Endpoint is the traces URL of the collector, e.g. http://localhost:4318/v1/traces
+	Endpoint string `toml:"Endpoint"`
+	// ServiceName identifies the proxy in the traces, reverseproxy by default
+	ServiceName string `toml:"ServiceName"`
+	// Headers are sent with every export, e.g. the credentials of the backend
+	Headers map[string]string `toml:"Headers"`
+}
+
+// Access log outputs
+const (
+	AccessLogStdout = "stdout"
+	AccessLogFile   = "file"
+	AccessLogSyslog = "syslog"
+)
+
+// AccessLogConfig configures the entry written for every request, without it entries go
+// through the application logger.
+type AccessLogConfig struct {
+	// Format is json, common or combined, json by default
+	Format string `toml:"Format"`
+	// Fields select the fields of the json format, accesslog.DefaultFields when empty
+	Fields []string `toml:"Fields"`
+	// Level is the minimum level logged: requests are info, 4xx warn and 5xx error. info by default
+	Level string `toml:"Level"`
+	// Output is stdout, file or syslog, stdout by default
+	Output string `toml:"Output"`
+	// Path of the file output
+	Path string `toml:"Path"`
+	// MaxSizeMB rotates the file when it reaches the size, 0 never rotates it
+	MaxSizeMB int `toml:"MaxSizeMB"`
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int `toml:"MaxBackups"`
+	// SyslogSocket is the local socket of the syslog daemon, the system default when empty
+	SyslogSocket string `toml:"SyslogSocket"`
+	// SyslogTag identifies the entries in syslog, reverseproxy by default
+	SyslogTag string `toml:"SyslogTag"`
+	// RedactHeaders are the headers whose values are never logged,
+	// accesslog.DefaultRedactHeaders when not set
+	RedactHeaders []string `toml:"RedactHeaders"`
+	// LogBodies logs the request and response bodies, selected by the body fields
+	LogBodies bool `toml:"LogBodies"`
+	// MaxBodyBytes truncates the bodies logged, accesslog.DefaultMaxBodyBytes by default
+	MaxBodyBytes int `toml:"MaxBodyBytes"`
+	// BodyContentTypes are the media types of the bodies logged, or prefixes ending in "/",
+	// accesslog.DefaultBodyContentTypes when empty
+	BodyContentTypes []string `toml:"BodyContentTypes"`
+}
+
+// TLSConfig serves the proxy over TLS, with ClientCAFile client certificates are verified
+// and can be matched by policies.
+type TLSConfig struct {
+	CertFile     string `toml:"CertFile"`
+	KeyFile      string `toml:"KeyFile"`
+	ClientCAFile string `toml:"ClientCAFile"`
+	// RequireClientCert rejects connections without a valid client certificate
+	RequireClientCert bool `toml:"RequireClientCert"`
+}
+
+// PolicyConfig selects the maskers applied to the requests matching Match.
+// Policies are evaluated in order and the first matching one wins, requests matching
+// none get every masker.
+type PolicyConfig struct {
+	Name string `toml:"Name"`
+	// Maskers are the types of the maskers applied, none when empty
+	Maskers []string    `toml:"Maskers"`
+	Match   PolicyMatch `toml:"Match"`
+}
+
+// PolicyMatch are the request attributes a policy matches, every criterion set must match.
+type PolicyMatch struct {
+	// Headers maps header names to their value, an empty value matches any value
+	Headers map[string]string `toml:"Headers"`
+	// ClientNames match the common name or a DNS name of the verified client certificate
+	ClientNames  []string `toml:"ClientNames"`
+	SourceCIDRs  []string `toml:"SourceCIDRs"`
+	PathPrefixes []string `toml:"PathPrefixes"`
+}
+
+// PluginsConfig lists blockers and maskers created through the proxy registry,
+// they run after the built-in ones in the order they are declared.
+type PluginsConfig struct {
+	Blockers []PluginConfig `toml:"Blockers"`
+	Maskers  []PluginConfig `toml:"Maskers"`
+}
+
+// PluginConfig is a generic entry, Type is the name the factory was registered with
+// and Options are decoded by the factory.
+type PluginConfig struct {
+	Type    string                 `toml:"type"`
+	Options map[string]interface{} `toml:"options"`
+}
+
+// Masker names used in MaskersConfig.Order
+const (
+	EmailMaskerName       = masker.EmailType
+	CreditCardMaskerName  = masker.CreditCardType
+	PhoneMaskerName       = masker.PhoneType
+	IBANMaskerName        = masker.IBANType
+	SSNMaskerName         = masker.SSNType
+	ArgentineIDMaskerName = masker.ArgentineIDType
+	IPMaskerName          = masker.IPType
+	SecretMaskerName      = masker.SecretType
+)
+
+// MaskerNames are the maskers MaskersConfig.Order accepts, every built-in masker but regex which
+// needs a pattern
+var MaskerNames = []string{EmailMaskerName, CreditCardMaskerName, PhoneMaskerName, IBANMaskerName,
+	SSNMaskerName, ArgentineIDMaskerName, IPMaskerName, SecretMaskerName}
+
+// DefaultMaskersOrder is the masker chain used when MaskersConfig.Order is empty
+var DefaultMaskersOrder = []string{EmailMaskerName, CreditCardMaskerName}
+
+// MaskersConfig configures the built-in maskers, a nil masker uses its defaults.
+type MaskersConfig struct {
+	// Order enables the maskers of MaskerNames and sets the order they run in, DefaultMaskersOrder
+	// if empty. Maskers without a section below use their defaults, the maskers with options are
+	// declared in Plugins.Maskers.
+	Order      []string                 `toml:"Order"`
+	Email      *masker.EmailMasker      `toml:"Email"`
+	CreditCard *masker.CreditCardMasker `toml:"CreditCard"`
+	// Tokenization replaces masked values with tokens in every masker
+	Tokenization *TokenizationConfig `toml:"Tokenization"`
+}
+
+// Tokenization modes
+const (
+	// TokenizationHMAC derives stable, non reversible tokens with a keyed HMAC
+	TokenizationHMAC = "hmac"
+	// TokenizationVault derives the same tokens as TokenizationHMAC and keeps the original values
+	// in a vault so they can be detokenized
+	TokenizationVault = "vault"
+)
+
+// Vault backends of TokenizationVault
+const (
+	VaultMemory = "memory"
+	VaultFile   = "file"
+)
+
+// TokenizationConfig configures how maskers replace values with tokens.
+type TokenizationConfig struct {
+	// Mode is the tokenization mode, TokenizationHMAC by default
+	Mode string `toml:"Mode"`
+	// Secret keys the HMAC, use ${VAR} to read it from the environment
+	Secret string `toml:"Secret"`
+	// Length is the number of hex characters of a token
+	Length int `toml:"Length"`
+	// Vault is the backend of TokenizationVault, VaultMemory by default
+	Vault string `toml:"Vault"`
+	// VaultPath is the file of VaultFile
+	VaultPath string `toml:"VaultPath"`
+	// VaultMaxEntries is the number of values the vault keeps, the oldest ones are dropped first,
+	// masker.DefaultVaultMaxEntries when 0
+	VaultMaxEntries int `toml:"VaultMaxEntries"`
+	// VaultTTL drops the values stored longer ago, e.g. "720h", values never expire when empty
+	VaultTTL string `toml:"VaultTTL"`
+	// DetokenizePath serves the detokenization endpoint of TokenizationVault, disabled when empty
+	DetokenizePath string `toml:"DetokenizePath"`
+	// DetokenizeAPIKeys are the bearer tokens accepted by the detokenization endpoint
+	DetokenizeAPIKeys []string `toml:"DetokenizeAPIKeys"`
+}
+
+// LoadConfig from a TOML, YAML or JSON file, the format is detected by extension.
+// ${VAR} references in string values are replaced with environment variables, top-level settings
+// can be overridden with EnvPrefix variables, and the config is validated rejecting unknown keys.
+func LoadConfig(path string) (*Config, error) {
+	src, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	conf := &Config{}
+	var errs ValidationErrors
+	// Line numbers are only reported for TOML files
+	withLines := false
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc interface{}
+		if err := yaml.Unmarshal(src, &doc); err != nil {
+			return nil, err
+		}
+		// Go through JSON so keys match the fields case-insensitively like in TOML
+		if src, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+		fallthrough
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(src))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(conf); err != nil {
+			return nil, err
+		}
+	default:
+		md, err := toml.Decode(string(src), conf)
+		if err != nil {
+			return nil, err
+		}
+		withLines = true
+		for _, key := range md.Undecoded() {
+			// Tables nested in plugin options are reported although they are decoded, the
+			// factories reject unknown options themselves
+			if len(key) > 3 && key[0] == "Plugins" && key[2] == "options" {
+				continue
+			}
+			errs = append(errs, ValidationError{Field: key.String(), Message: "unknown key", Line: keyLine(src, key.String())})
+		}
+	}
+	if err := interpolateEnv(conf, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	errs = append(errs, applyEnvOverrides(conf, os.LookupEnv)...)
+	if err := conf.Validate(); err != nil {
+		for _, e := range err.(ValidationErrors) {
+			if withLines {
+				e.Line = keyLine(src, e.Field)
+			}
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return conf, nil
 }
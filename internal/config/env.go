@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding top-level settings,
+// e.g. REVERSEPROXY_TARGET_URL overrides TargetURL.
+const EnvPrefix = "REVERSEPROXY_"
+
+// envVarRegexp matches ${VAR}, ${VAR:-default} and $${, the escape of a literal ${
+var envVarRegexp = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolateEnv replaces every ${VAR} in the string values of conf with the value of the
+// environment variable VAR, or with default for ${VAR:-default} when VAR is not set. Values are
+// replaced after the file is decoded, so they can't change its structure. $${ is kept as ${ and
+// other uses of $ are left intact.
+func interpolateEnv(conf *Config, lookup func(string) (string, bool)) error {
+	var missing []string
+	expand := func(s string) string {
+		if !strings.Contains(s, "${") {
+			return s
+		}
+		return envVarRegexp.ReplaceAllStringFunc(s, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			groups := envVarRegexp.FindStringSubmatchIndex(match)
+			name := match[groups[2]:groups[3]]
+			if value, ok := lookup(name); ok {
+				return value
+			}
+			if groups[4] >= 0 {
+				return match[groups[4]:groups[5]]
+			}
+			missing = append(missing, name)
+			return match
+		})
+	}
+	interpolateValue(reflect.ValueOf(conf).Elem(), expand)
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// interpolateValue applies expand to every string reachable from the exported fields of v
+func interpolateValue(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expand(v.String()))
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		// Values decoded into interface{} are plain strings, maps and slices
+		if s, ok := v.Elem().Interface().(string); ok && v.CanSet() {
+			v.Set(reflect.ValueOf(expand(s)))
+			return
+		}
+		interpolateValue(v.Elem(), expand)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			interpolateValue(v.Elem(), expand)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				interpolateValue(v.Field(i), expand)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			interpolateValue(v.Index(i), expand)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values can't be set in place, they are copied and stored back
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			interpolateValue(value, expand)
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+}
+
+// applyEnvOverrides sets every top-level string, int and bool setting that has a
+// EnvPrefix environment variable defined.
+func applyEnvOverrides(conf *Config, lookup func(string) (string, bool)) ValidationErrors {
+	var errs ValidationErrors
+	v := reflect.ValueOf(conf).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := EnvPrefix + screamingSnake(field.Name)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString(value)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, ValidationError{Field: name, Message: "must be an integer"})
+				continue
+			}
+			f.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, ValidationError{Field: name, Message: "must be a boolean"})
+				continue
+			}
+			f.SetBool(b)
+		default:
+			errs = append(errs, ValidationError{Field: name, Message: "only top-level values can be overridden"})
+		}
+	}
+	return errs
+}
+
+// screamingSnake converts a field name like ReverseProxyPort or TargetURL to REVERSE_PROXY_PORT or TARGET_URL
+func screamingSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package config
+
+import "net/url"
+
+// Redacted replaces the secret values of a printed config
+const Redacted = "[REDACTED]"
+
+// RedactSecrets replaces the values of c that can be credentials with Redacted so c can be printed:
+// the password of TargetURL, the values blocked by HeaderBlocker and ParamBlocker, the tokenization
+// secret and API keys, the tracing headers, the header values matched by policies and the values
+// set by header rules. Empty values, which match any value, are kept. c can't run the proxy anymore.
+func (c *Config) RedactSecrets() {
+	if u, err := url.Parse(c.TargetURL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+			c.TargetURL = u.String()
+		}
+	}
+	if c.HeaderBlocker != nil {
+		redactValues(c.HeaderBlocker.HeaderMap)
+	}
+	if c.ParamBlocker != nil {
+		redactValues(c.ParamBlocker.ParamsMap)
+	}
+	if c.Maskers != nil && c.Maskers.Tokenization != nil {
+		tc := c.Maskers.Tokenization
+		if tc.Secret != "" {
+			tc.Secret = Redacted
+		}
+		for i := range tc.DetokenizeAPIKeys {
+			tc.DetokenizeAPIKeys[i] = Redacted
+		}
+	}
+	if c.Tracing != nil {
+		redactValues(c.Tracing.Headers)
+	}
+	for i := range c.Policies {
+		redactValues(c.Policies[i].Match.Headers)
+	}
+	for i := range c.HeaderRules {
+		for _, ops := range []map[string]string{c.HeaderRules[i].Request.Set, c.HeaderRules[i].Request.Add,
+			c.HeaderRules[i].Response.Set, c.HeaderRules[i].Response.Add} {
+			redactValues(ops)
+		}
+	}
+}
+
+func redactValues(values map[string]string) {
+	for name, value := range values {
+		if value != "" {
+			values[name] = Redacted
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Diff returns a human-readable line for every top-level setting that differs between old and new.
+// The lines only name the settings, their values can be credentials.
+func Diff(old, new *Config) []string {
+	var changes []string
+	oldValue, newValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		name := oldValue.Type().Field(i).Name
+		before, after := oldValue.Field(i), newValue.Field(i)
+		if before.Kind() == reflect.Pointer {
+			switch {
+			case before.IsNil() && after.IsNil():
+				continue
+			case before.IsNil():
+				changes = append(changes, name+" added")
+				continue
+			case after.IsNil():
+				changes = append(changes, name+" removed")
+				continue
+			}
+			if encode(before.Interface()) != encode(after.Interface()) {
+				changes = append(changes, name+" changed")
+			}
+			continue
+		}
+		if !reflect.DeepEqual(before.Interface(), after.Interface()) {
+			changes = append(changes, name+" changed")
+		}
+	}
+	return changes
+}
+
+// encode renders a config section as TOML so sections are compared by their settings only
+func encode(v interface{}) string {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+// Watch polls the file at path every interval and sends on the returned channel when its
+// modification time or size changes, until stop is closed.
+func Watch(path string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	last, _ := os.Stat(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			current, err := os.Stat(path)
+			if err != nil {
+				// The file may be in the middle of being replaced, check again later
+				continue
+			}
+			if last != nil && current.ModTime().Equal(last.ModTime()) && current.Size() == last.Size() {
+				continue
+			}
+			last = current
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changed
+}
@@ -0,0 +1,520 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"reverseproxy/internal/accesslog"
+	"reverseproxy/internal/masker"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+)
+
+// ValidationError describes a single invalid setting.
+type ValidationError struct {
+	// Field is the dotted path of the setting, e.g. HeaderBlocker.HeaderMap
+	Field string
+	// Line is the line of the setting in the config file, 0 when unknown
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors is every problem found in a config.
+type ValidationErrors []ValidationError
+
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(ve))
+	for _, e := range ve {
+		msgs = append(msgs, e.Error())
+	}
+	return "invalid config:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// minTokenizationSecret is the shortest HMAC secret accepted
+const minTokenizationSecret = 16
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Validate checks the config and returns ValidationErrors with every problem found.
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.TargetURL == "" {
+		add("TargetURL", "is required")
+	} else if u, err := url.Parse(c.TargetURL); err != nil {
+		add("TargetURL", "%v", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		add("TargetURL", "scheme must be http or https, got %q", u.Scheme)
+	} else if u.Host == "" {
+		add("TargetURL", "host is required")
+	}
+	if c.ReverseProxyPort < 1 || c.ReverseProxyPort > 65535 {
+		add("ReverseProxyPort", "must be between 1 and 65535, got %d", c.ReverseProxyPort)
+	}
+
+	if c.HeaderBlocker != nil && len(c.HeaderBlocker.HeaderMap) == 0 {
+		add("HeaderBlocker.HeaderMap", "must have at least one header")
+	}
+	if c.ParamBlocker != nil && len(c.ParamBlocker.ParamsMap) == 0 {
+		add("ParamBlocker.ParamsMap", "must have at least one param")
+	}
+	if c.PathBlocker != nil {
+		if len(c.PathBlocker.Path) == 0 {
+			add("PathBlocker.Path", "must have at least one path")
+		}
+		for _, p := range c.PathBlocker.Path {
+			if !strings.HasPrefix(p, "/") {
+				add("PathBlocker.Path", "path %q must start with /", p)
+			}
+		}
+	}
+	if c.MethodBlocker != nil {
+		if len(c.MethodBlocker.Method) == 0 {
+			add("MethodBlocker.Method", "must have at least one method")
+		}
+		for _, m := range c.MethodBlocker.Method {
+			if !knownMethods[m] {
+				add("MethodBlocker.Method", "unknown method %q", m)
+			}
+		}
+	}
+	if c.BodyBlocker != nil {
+		if c.BodyBlocker.MaxBodyBytes < 0 {
+			add("BodyBlocker.MaxBodyBytes", "must not be negative")
+		}
+		if err := c.BodyBlocker.Compile(); err != nil {
+			add("BodyBlocker", "%v", err)
+		}
+	}
+
+	if c.Maskers != nil {
+		seen, configurable := map[string]bool{}, map[string]bool{}
+		for _, name := range MaskerNames {
+			configurable[name] = true
+		}
+		for _, name := range c.Maskers.Order {
+			if !configurable[name] {
+				if _, err := proxy.NewMasker(name, nil); err != nil {
+					add("Maskers.Order", "%v", err)
+				} else {
+					add("Maskers.Order", "masker %q needs options, declare it in [[Plugins.Maskers]]", name)
+				}
+			} else if seen[name] {
+				add("Maskers.Order", "masker %q listed twice", name)
+			}
+			seen[name] = true
+		}
+		if c.Maskers.Email != nil {
+			validateMaskChar(add, "Maskers.Email.MaskChar", c.Maskers.Email.MaskChar)
+		}
+		if c.Maskers.CreditCard != nil {
+			validateMaskChar(add, "Maskers.CreditCard.MaskChar", c.Maskers.CreditCard.MaskChar)
+		}
+		if t := c.Maskers.Tokenization; t != nil {
+			if t.Mode != "" && t.Mode != TokenizationHMAC && t.Mode != TokenizationVault {
+				add("Maskers.Tokenization.Mode", "unknown mode %q", t.Mode)
+			}
+			if t.Mode == TokenizationVault {
+				validateVault(add, t)
+			} else if t.Vault != "" || t.VaultPath != "" || t.VaultMaxEntries != 0 || t.VaultTTL != "" ||
+				t.DetokenizePath != "" {
+				add("Maskers.Tokenization.Mode", "must be %q to use a vault", TokenizationVault)
+			}
+			if len(t.Secret) < minTokenizationSecret {
+				add("Maskers.Tokenization.Secret", "must have at least %d characters", minTokenizationSecret)
+			}
+			if t.Length != 0 && (t.Length < masker.MinTokenLength || t.Length > 64) {
+				add("Maskers.Tokenization.Length", "must be between %d and 64, or 0 for the default, got %d",
+					masker.MinTokenLength, t.Length)
+			}
+		}
+	}
+
+	if c.Plugins != nil {
+		for i, p := range c.Plugins.Blockers {
+			if _, err := proxy.NewBlocker(p.Type, p.Options); err != nil {
+				add(fmt.Sprintf("Plugins.Blockers[%d]", i), "%v", err)
+			}
+		}
+		for i, p := range c.Plugins.Maskers {
+			if _, err := proxy.NewMasker(p.Type, p.Options); err != nil {
+				add(fmt.Sprintf("Plugins.Maskers[%d]", i), "%v", err)
+			}
+		}
+	}
+
+	if c.TLS != nil {
+		if c.TLS.CertFile == "" {
+			add("TLS.CertFile", "is required")
+		}
+		if c.TLS.KeyFile == "" {
+			add("TLS.KeyFile", "is required")
+		}
+		if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+			add("TLS.ClientCAFile", "is required by RequireClientCert")
+		}
+	}
+
+	enabled := c.maskerTypes()
+	names := map[string]bool{}
+	for i, p := range c.Policies {
+		field := fmt.Sprintf("Policies[%d]", i)
+		if p.Name == "" {
+			add(field+".Name", "is required")
+		} else if names[p.Name] {
+			add(field+".Name", "policy %q declared twice", p.Name)
+		}
+		names[p.Name] = true
+		for _, m := range p.Maskers {
+			if !enabled[m] {
+				add(field+".Maskers", "masker %q is not enabled", m)
+			}
+		}
+		match := p.Match
+		if len(match.Headers) == 0 && len(match.ClientNames) == 0 && len(match.SourceCIDRs) == 0 &&
+			len(match.PathPrefixes) == 0 {
+			add(field+".Match", "must have at least one criterion")
+		}
+		if len(match.ClientNames) > 0 && (c.TLS == nil || c.TLS.ClientCAFile == "") {
+			add(field+".Match.ClientNames", "requires TLS.ClientCAFile")
+		}
+		for _, cidr := range match.SourceCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				add(field+".Match.SourceCIDRs", "%v", err)
+			}
+		}
+		for _, prefix := range match.PathPrefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				add(field+".Match.PathPrefixes", "path %q must start with /", prefix)
+			}
+		}
+	}
+
+	if c.RequestIDHeader != "" && !validHeaderName(c.RequestIDHeader) {
+		add("RequestIDHeader", "invalid header name %q", c.RequestIDHeader)
+	}
+	if f := c.Forwarding; f != nil {
+		known := map[string]bool{}
+		for _, h := range []string{proxy.HeaderXForwardedFor, proxy.HeaderXForwardedHost, proxy.HeaderXForwardedProto,
+			proxy.HeaderForwarded, proxy.HeaderVia} {
+			known[h] = true
+		}
+		for _, h := range f.Headers {
+			if !known[http.CanonicalHeaderKey(h)] {
+				add("Forwarding.Headers", "unknown forwarding header %q", h)
+			}
+		}
+		if f.Via != "" && !validHeaderName(f.Via) {
+			add("Forwarding.Via", "invalid pseudonym %q", f.Via)
+		}
+		for _, cidr := range f.TrustedProxies {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				add("Forwarding.TrustedProxies", "%v", err)
+			}
+		}
+	}
+	for i, hr := range c.HeaderRules {
+		field := fmt.Sprintf("HeaderRules[%d]", i)
+		for _, prefix := range hr.PathPrefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				add(field+".PathPrefixes", "path %q must start with /", prefix)
+			}
+		}
+		validateHeaderOps(add, field+".Request", &hr.Request)
+		validateHeaderOps(add, field+".Response", &hr.Response)
+	}
+	for i, rr := range c.RewriteRules {
+		field := fmt.Sprintf("RewriteRules[%d]", i)
+		pattern, err := regexp.Compile(rr.Pattern)
+		if err != nil {
+			add(field+".Pattern", "%v", err)
+		} else if rr.Pattern == "" {
+			add(field+".Pattern", "is required")
+		}
+		switch rr.Redirect {
+		case 0:
+			if rr.Replacement != "" && !strings.HasPrefix(rr.Replacement, "/") {
+				add(field+".Replacement", "must be a path starting with / unless the rule redirects")
+			}
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			// A redirect to a path the rule matches again never ends
+			switch {
+			case rr.Replacement == "":
+				add(field+".Replacement", "is required when the rule redirects")
+			case pattern != nil && !strings.Contains(rr.Replacement, "$") && pattern.MatchString(rr.Replacement):
+				add(field+".Replacement", "redirects to %q, which matches Pattern again", rr.Replacement)
+			}
+		default:
+			add(field+".Redirect", "must be 301, 302, 307 or 308, got %d", rr.Redirect)
+		}
+		if rr.Replacement == "" && rr.Redirect == 0 && len(rr.AddQuery) == 0 && len(rr.RemoveQuery) == 0 {
+			add(field, "must rewrite the path or the query, or redirect")
+		}
+	}
+	if s := c.Streaming; s != nil {
+		for _, ct := range s.ContentTypes {
+			if _, _, err := mime.ParseMediaType(ct); err != nil {
+				add("Streaming.ContentTypes", "invalid media type %q", ct)
+			}
+		}
+		if s.FlushInterval != "" {
+			if _, err := time.ParseDuration(s.FlushInterval); err != nil {
+				add("Streaming.FlushInterval", "%v", err)
+			}
+		}
+	}
+	if c.Tracing != nil {
+		if c.Tracing.Endpoint == "" {
+			add("Tracing.Endpoint", "is required")
+		} else if u, err := url.Parse(c.Tracing.Endpoint); err != nil {
+			add("Tracing.Endpoint", "%v", err)
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("Tracing.Endpoint", "must be an http or https URL, got %q", c.Tracing.Endpoint)
+		}
+	}
+	if c.AccessLog != nil {
+		validateAccessLog(add, c.AccessLog)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// maskerTypes returns the types of the maskers in the chain
+func (c *Config) maskerTypes() map[string]bool {
+	types := map[string]bool{}
+	order := DefaultMaskersOrder
+	if c.Maskers != nil && len(c.Maskers.Order) > 0 {
+		order = c.Maskers.Order
+	}
+	for _, name := range order {
+		types[name] = true
+	}
+	if c.Plugins != nil {
+		for _, p := range c.Plugins.Maskers {
+			types[p.Type] = true
+		}
+	}
+	return types
+}
+
+// templateVar matches the placeholders of header values
+var templateVar = regexp.MustCompile(`\{[^{}]*\}`)
+
+func validateHeaderOps(add func(field, format string, args ...interface{}), field string, ops *proxy.HeaderOps) {
+	known := map[string]bool{}
+	for _, v := range proxy.HeaderTemplateVars {
+		known[v] = true
+	}
+	for from, to := range ops.Rename {
+		if !validHeaderName(from) || !validHeaderName(to) || to == "" {
+			add(field+".Rename", "invalid header names %q to %q", from, to)
+		}
+	}
+	for _, name := range ops.Remove {
+		if name == "" || !validHeaderName(name) {
+			add(field+".Remove", "invalid header name %q", name)
+		}
+	}
+	for kind, values := range map[string]map[string]string{"Set": ops.Set, "Add": ops.Add} {
+		for name, value := range values {
+			if name == "" || !validHeaderName(name) {
+				add(field+"."+kind, "invalid header name %q", name)
+			}
+			for _, v := range templateVar.FindAllString(value, -1) {
+				if !known[v] {
+					add(field+"."+kind, "unknown placeholder %s in %q", v, name)
+				}
+			}
+		}
+	}
+}
+
+// validHeaderName reports whether name is an HTTP token
+func validHeaderName(name string) bool {
+	for _, r := range name {
+		if r > '~' || !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' ||
+			strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func validateAccessLog(add func(field, format string, args ...interface{}), a *AccessLogConfig) {
+	switch a.Format {
+	case "", accesslog.FormatJSON:
+		known := map[string]bool{}
+		for _, f := range accesslog.Fields {
+			known[f] = true
+		}
+		for _, f := range a.Fields {
+			if !known[f] {
+				add("AccessLog.Fields", "unknown field %q", f)
+			}
+			if (f == accesslog.FieldRequestBody || f == accesslog.FieldResponseBody) && !a.LogBodies {
+				add("AccessLog.Fields", "field %q requires LogBodies", f)
+			}
+		}
+	case accesslog.FormatCommon, accesslog.FormatCombined:
+		if len(a.Fields) > 0 {
+			add("AccessLog.Fields", "only apply to the %q format", accesslog.FormatJSON)
+		}
+	default:
+		add("AccessLog.Format", "unknown format %q", a.Format)
+	}
+	if a.Level != "" {
+		if _, err := zerolog.ParseLevel(a.Level); err != nil {
+			add("AccessLog.Level", "%v", err)
+		}
+	}
+	switch a.Output {
+	case "", AccessLogStdout, AccessLogSyslog:
+		if a.Path != "" {
+			add("AccessLog.Path", "only applies to the %q output", AccessLogFile)
+		}
+	case AccessLogFile:
+		if a.Path == "" {
+			add("AccessLog.Path", "is required by the %q output", AccessLogFile)
+		}
+	default:
+		add("AccessLog.Output", "unknown output %q", a.Output)
+	}
+	if a.MaxSizeMB < 0 {
+		add("AccessLog.MaxSizeMB", "must not be negative")
+	}
+	if a.MaxBackups < 0 {
+		add("AccessLog.MaxBackups", "must not be negative")
+	}
+	if a.MaxBodyBytes < 0 {
+		add("AccessLog.MaxBodyBytes", "must not be negative")
+	}
+	for _, h := range a.RedactHeaders {
+		if strings.TrimSpace(h) == "" {
+			add("AccessLog.RedactHeaders", "must not contain empty names")
+		}
+	}
+	if !a.LogBodies && (a.MaxBodyBytes != 0 || len(a.BodyContentTypes) > 0) {
+		add("AccessLog.LogBodies", "is required by MaxBodyBytes and BodyContentTypes")
+	}
+}
+
+func validateVault(add func(field, format string, args ...interface{}), t *TokenizationConfig) {
+	switch t.Vault {
+	case "", VaultMemory:
+		if t.VaultPath != "" {
+			add("Maskers.Tokenization.VaultPath", "only applies to the %q vault", VaultFile)
+		}
+	case VaultFile:
+		if t.VaultPath == "" {
+			add("Maskers.Tokenization.VaultPath", "is required by the %q vault", VaultFile)
+		}
+	default:
+		add("Maskers.Tokenization.Vault", "unknown vault %q", t.Vault)
+	}
+	if t.VaultMaxEntries < 0 {
+		add("Maskers.Tokenization.VaultMaxEntries", "must not be negative")
+	}
+	if t.VaultTTL != "" {
+		if ttl, err := time.ParseDuration(t.VaultTTL); err != nil {
+			add("Maskers.Tokenization.VaultTTL", "%v", err)
+		} else if ttl <= 0 {
+			add("Maskers.Tokenization.VaultTTL", "must be positive")
+		}
+	}
+	if t.DetokenizePath == "" {
+		if len(t.DetokenizeAPIKeys) > 0 {
+			add("Maskers.Tokenization.DetokenizeAPIKeys", "requires DetokenizePath")
+		}
+		return
+	}
+	if !strings.HasPrefix(t.DetokenizePath, "/") {
+		add("Maskers.Tokenization.DetokenizePath", "path %q must start with /", t.DetokenizePath)
+	}
+	if len(t.DetokenizeAPIKeys) == 0 {
+		add("Maskers.Tokenization.DetokenizeAPIKeys", "must have at least one key")
+	}
+	for _, k := range t.DetokenizeAPIKeys {
+		if len(k) < minTokenizationSecret {
+			add("Maskers.Tokenization.DetokenizeAPIKeys", "keys must have at least %d characters", minTokenizationSecret)
+			break
+		}
+	}
+}
+
+func validateMaskChar(add func(field, format string, args ...interface{}), field, maskChar string) {
+	if utf8.RuneCountInString(maskChar) > 1 {
+		add(field, "must be a single character, got %q", maskChar)
+	}
+}
+
+// keyLine returns the line where the dotted key is defined in the TOML src, 0 if not found.
+// Keys are matched case-insensitively like the decoder does.
+func keyLine(src []byte, key string) int {
+	var table, array string
+	// arrays of tables are referenced as Name[i]
+	arrays := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasPrefix(text, "[["):
+			array = strings.Trim(text, "[] \t")
+			arrays[array]++
+			table = fmt.Sprintf("%s[%d]", array, arrays[array]-1)
+			if strings.EqualFold(table, key) {
+				return line
+			}
+			continue
+		case strings.HasPrefix(text, "["):
+			table = strings.Trim(text, "[] \t")
+			if array != "" && strings.HasPrefix(table, array+".") {
+				table = fmt.Sprintf("%s[%d]%s", array, arrays[array]-1, strings.TrimPrefix(table, array))
+			}
+			if strings.EqualFold(table, key) {
+				return line
+			}
+			continue
+		}
+		name, _, ok := strings.Cut(text, "=")
+		if !ok {
+			continue
+		}
+		name = strings.Trim(strings.TrimSpace(name), `"'`)
+		if table != "" {
+			name = table + "." + name
+		}
+		if strings.EqualFold(name, key) {
+			return line
+		}
+	}
+	return 0
+}
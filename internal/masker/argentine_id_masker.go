@@ -0,0 +1,90 @@
+package masker
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+
+	"reverseproxy/internal/scan"
+)
+
+var argentineIDPatterns = []piiPattern{
+	// CUIT and CUIL, e.g. 20-12345678-6 or 20123456786
+	{
+		re:    regexp.MustCompile(`(?:20|23|24|27|30|33|34)-?\d{8}-?\d`),
+		valid: func(match []byte) bool { return validCUIT(match) },
+	},
+	// DNI with thousands separators, e.g. 12.345.678, plain numbers are too ambiguous
+	{
+		re: regexp.MustCompile(`\d{1,2}\.\d{3}\.\d{3}`),
+		valid: func(match []byte) bool {
+			return match[0] != '0'
+		},
+		bounded: dniBounded,
+	},
+}
+
+// dniBounded rejects the amounts written like a DNI: part of a longer number with separators,
+// with decimals or after a currency sign, e.g. 1.112.345.678, 12.345.678,50 or $ 12.345.678
+func dniBounded(text []byte, start, end int) bool {
+	before := bytes.TrimRight(text[:start], " ")
+	if n := len(before); n > 0 && (before[n-1] == '.' || before[n-1] == ',' || before[n-1] == '$') {
+		return false
+	}
+	after := text[end:]
+	return len(after) < 2 || (after[0] != '.' && after[0] != ',') || !isDigit(after[1])
+}
+
+// ArgentineIDMasker masks Argentine CUIT/CUIL numbers with a valid check digit and DNI numbers
+type ArgentineIDMasker struct {
+	Mode
+	// MaskChar replaces the masked digits, '*' by default
+	MaskChar string
+}
+
+// NewArgentineIDMasker creates an Argentine ID masker
+func NewArgentineIDMasker() *ArgentineIDMasker {
+	return &ArgentineIDMasker{}
+}
+
+// Mask every CUIT, CUIL and DNI found in text, replace every digit with '*'
+func (am *ArgentineIDMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	return am.maskPII(ctx, "argentine_id", text, findPII(text, argentineIDPatterns...), maskRune(am.MaskChar))
+}
+
+// CountMatches returns how many IDs Mask would replace in text.
+func (am *ArgentineIDMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(findPII(text, argentineIDPatterns...))
+}
+
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (am *ArgentineIDMasker) ScanRules() []*scan.Rule {
+	return am.piiRules("argentine_id", maskRune(am.MaskChar), argentineIDPatterns...)
+}
+
+// Name ...
+func (am *ArgentineIDMasker) Name() string {
+	return "Argentine ID Masker"
+}
+
+// validCUIT checks the mod 11 check digit of a CUIT or CUIL
+func validCUIT(cuit []byte) bool {
+	d := digits(cuit)
+	if len(d) != 11 {
+		return false
+	}
+	weights := [10]int{5, 4, 3, 2, 7, 6, 5, 4, 3, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(d[i]-'0') * w
+	}
+	check := 11 - sum%11
+	switch check {
+	case 11:
+		check = 0
+	case 10:
+		// Numbers with check 10 are reissued with another prefix
+		return false
+	}
+	return int(d[10]-'0') == check
+}
@@ -0,0 +1,47 @@
+package masker_test
+
+import (
+	"context"
+	"testing"
+
+	"reverseproxy/internal/masker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgentineIDMasker_Mask(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"CUIT":             {input: "cuit 20-12345678-6", expected: "cuit **-********-*"},
+		"CUILNoDashes":     {input: "cuil 27334455667", expected: "cuil ***********"},
+		"CompanyCUIT":      {input: "cuit 30-71234567-1", expected: "cuit **-********-*"},
+		"InvalidCheck":     {input: "cuit 20-12345678-5", expected: "cuit 20-12345678-5"},
+		"InvalidPrefix":    {input: "cuit 21-12345678-6", expected: "cuit 21-12345678-6"},
+		"DNI":              {input: "dni 12.345.678", expected: "dni **.***.***"},
+		"ShortDNI":         {input: "dni 5.345.678", expected: "dni *.***.***"},
+		"DNILeadingZero":   {input: "dni 05.345.678", expected: "dni 05.345.678"},
+		"PlainEightDigits": {input: "order 12345678", expected: "order 12345678"},
+		"DNIEndOfSentence": {input: "dni 12.345.678.", expected: "dni **.***.***."},
+		"Amount":           {input: "total $ 12.345.678", expected: "total $ 12.345.678"},
+		"AmountDecimals":   {input: "total 12.345.678,50", expected: "total 12.345.678,50"},
+		"LongerAmount":     {input: "total 1.112.345.678", expected: "total 1.112.345.678"},
+	}
+	m := masker.NewArgentineIDMasker()
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := m.Mask(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestArgentineIDMasker_Name(t *testing.T) {
+	m := masker.NewArgentineIDMasker()
+	if m.Name() != "Argentine ID Masker" {
+		t.Errorf("Expected: %s, Got: %s", "Argentine ID Masker", m.Name())
+	}
+}
@@ -0,0 +1,60 @@
+package masker
+
+import "strconv"
+
+// iinRange is a range of issuer identification numbers with the given number of leading digits
+type iinRange struct {
+	digits   int
+	from, to int
+}
+
+// network is a card network with its IIN ranges and valid card number lengths
+type network struct {
+	name    string
+	ranges  []iinRange
+	lengths []int
+}
+
+// networks is checked in order, so narrower ranges must go before the ones containing them
+var networks = []network{
+	{name: "Amex", ranges: []iinRange{{2, 34, 34}, {2, 37, 37}}, lengths: []int{15}},
+	{name: "Diners Club", ranges: []iinRange{{3, 300, 305}, {2, 36, 36}, {2, 38, 39}}, lengths: []int{14, 15, 16, 17, 18, 19}},
+	{name: "JCB", ranges: []iinRange{{4, 3528, 3589}}, lengths: []int{16, 17, 18, 19}},
+	{name: "Visa", ranges: []iinRange{{1, 4, 4}}, lengths: []int{13, 16, 19}},
+	{name: "Maestro", ranges: []iinRange{{4, 5018, 5018}, {4, 5020, 5020}, {4, 5038, 5038}, {4, 5893, 5893},
+		{4, 6304, 6304}, {4, 6759, 6759}, {4, 6761, 6763}}, lengths: []int{12, 13, 14, 15, 16, 17, 18, 19}},
+	{name: "Mastercard", ranges: []iinRange{{2, 51, 55}, {4, 2221, 2720}}, lengths: []int{16}},
+	{name: "Discover", ranges: []iinRange{{4, 6011, 6011}, {6, 622126, 622925}, {3, 644, 649}, {2, 65, 65}},
+		lengths: []int{16, 17, 18, 19}},
+	{name: "UnionPay", ranges: []iinRange{{2, 62, 62}}, lengths: []int{16, 17, 18, 19}},
+}
+
+// cardNetwork returns the network of the card number, only digits, or "" if it is unknown
+// or its length is not valid for the network
+func cardNetwork(number string) string {
+	for _, n := range networks {
+		if !n.matches(number) {
+			continue
+		}
+		for _, l := range n.lengths {
+			if len(number) == l {
+				return n.name
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+func (n network) matches(number string) bool {
+	for _, r := range n.ranges {
+		if len(number) < r.digits {
+			continue
+		}
+		prefix, err := strconv.Atoi(number[:r.digits])
+		if err == nil && prefix >= r.from && prefix <= r.to {
+			return true
+		}
+	}
+	return false
+}
@@ -5,14 +5,34 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"reverseproxy/internal/scan"
+)
+
+// Card numbers have 12 to 19 digits
+const (
+	minCardDigits = 12
+	maxCardDigits = 19
 )
 
-const creditCardBasePattern = `(?:\d[ -]*?){13,16}`
+// creditCardBasePattern matches 12 to 19 digits, with spaces or dashes between them
+const creditCardBasePattern = `\d(?:[ -]*\d){11,18}`
 
 var creditCardBaseRegexp = regexp.MustCompile(creditCardBasePattern)
 
 // CreditCardMasker credit card masker
-type CreditCardMasker struct{}
+type CreditCardMasker struct {
+	Mode
+	// MaskChar replaces the masked digits, '*' by default
+	MaskChar string
+	// KeepFirstSix keeps the BIN, the first six digits, unmasked
+	KeepFirstSix bool
+	// KeepLastFour keeps the last four digits unmasked
+	KeepLastFour bool
+	// IdentifyNetwork appends the card network to the masked number, e.g. "(Visa)",
+	// when the number is in the network IIN ranges and has a valid length for it
+	IdentifyNetwork bool
+}
 
 // NewCreditCardMasker creates a cc masker
 func NewCreditCardMasker() *CreditCardMasker {
@@ -22,21 +42,42 @@ func NewCreditCardMasker() *CreditCardMasker {
 // Mask every cc found in text, replace every cc digit with '*'
 func (ccm *CreditCardMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
 	// Replace the matched credit card numbers with masked values
-	maskedText := creditCardBaseRegexp.ReplaceAllStringFunc(string(text), func(cc string) string {
-		// Replace - and space characters with empty strings to check luhn
-		var onlyDigits strings.Builder
-		for _, r := range cc {
-			if r >= '0' && r <= '9' {
-				onlyDigits.WriteRune(r)
-			}
-		}
-		if luhn(onlyDigits.String()) {
-			return maskCreditCard(cc)
-		}
-		return cc
+	return replaceMatches(text, findCards(text), func(cc []byte) ([]byte, error) {
+		return ccm.replace(ctx, cc)
 	})
+}
 
-	return []byte(maskedText), nil
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (ccm *CreditCardMasker) ScanRules() []*scan.Rule {
+	return []*scan.Rule{{
+		Regexp: creditCardBaseRegexp,
+		Fit:    cardEnd,
+		Replace: func(ctx context.Context, text []byte, m []int) ([]byte, error) {
+			return ccm.replace(ctx, text[m[0]:m[1]])
+		},
+	}}
+}
+
+// replace returns the masked or tokenized cc, followed by its network when identified
+func (ccm *CreditCardMasker) replace(ctx context.Context, cc []byte) ([]byte, error) {
+	number := onlyDigits(string(cc))
+	masked, err := ccm.tokenOr(ctx, "card", []byte(number), func() []byte {
+		return []byte(ccm.maskCreditCard(string(cc), len(number)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ccm.IdentifyNetwork {
+		if network := cardNetwork(number); network != "" {
+			masked = append(masked, " ("+network+")"...)
+		}
+	}
+	return masked, nil
+}
+
+// CountMatches returns how many credit cards Mask would replace in text.
+func (ccm *CreditCardMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(findCards(text))
 }
 
 // Name ...
@@ -44,23 +85,110 @@ func (ccm *CreditCardMasker) Name() string {
 	return "Credit Card Masker"
 }
 
-func maskCreditCard(cc string) string {
-	maskedCC := ""
+// findCards returns the bounds of the card numbers in text
+func findCards(text []byte) [][2]int {
+	var cards [][2]int
+	for pos := 0; pos < len(text); {
+		loc := creditCardBaseRegexp.FindIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		end, ok := cardEnd(text, start, pos+loc[1])
+		if ok {
+			cards = append(cards, [2]int{start, end})
+		}
+		pos = end
+	}
+	return cards
+}
+
+// cardEnd returns the end of the card number matched at text[start:end]. The number can't be part
+// of a longer run of digits and must pass the Luhn check, the digit groups ending the match are
+// dropped until it does, e.g. an expiry date following the number. Otherwise it returns false and
+// the end of the digit groups checked, where the next number is searched from.
+func cardEnd(text []byte, start, end int) (int, bool) {
+	if start > 0 && isDigit(text[start-1]) {
+		return skipDigits(text, start), false
+	}
+	next := -1
+	for end > start {
+		if end == len(text) || !isDigit(text[end]) {
+			if next < 0 {
+				next = end
+			}
+			number := onlyDigits(string(text[start:end]))
+			if len(number) < minCardDigits {
+				break
+			}
+			if luhn(number) {
+				return end, true
+			}
+		}
+		for end > start && isDigit(text[end-1]) {
+			end--
+		}
+		for end > start && !isDigit(text[end-1]) {
+			end--
+		}
+	}
+	if next < 0 {
+		// The match is a run of more than 19 digits
+		next = skipDigits(text, start)
+	}
+	return next, false
+}
+
+// skipDigits returns the end of the digits starting at text[i:]
+func skipDigits(text []byte, i int) int {
+	for i < len(text) && isDigit(text[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// onlyDigits drops - and space characters from cc to check luhn
+func onlyDigits(cc string) string {
+	var digits strings.Builder
+	for _, r := range cc {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+// maskCreditCard replaces the digits of cc, which has n digits, keeping separators
+// and the digits configured to be kept
+func (ccm *CreditCardMasker) maskCreditCard(cc string, n int) string {
+	mask := maskRune(ccm.MaskChar)
+	var maskedCC strings.Builder
+	maskedCC.Grow(len(cc))
+	digit := 0
 	for i := 0; i < len(cc); i++ {
 		if cc[i] < '0' || cc[i] > '9' {
-			maskedCC += string(cc[i])
+			maskedCC.WriteByte(cc[i])
 			continue
 		}
-		maskedCC += "*"
+		if (ccm.KeepFirstSix && digit < 6) || (ccm.KeepLastFour && digit >= n-4) {
+			maskedCC.WriteByte(cc[i])
+		} else {
+			maskedCC.WriteRune(mask)
+		}
+		digit++
 	}
-	return maskedCC
+	return maskedCC.String()
 }
 
 func luhn(s string) bool {
 	var sum int
 	var alternate bool
 	numberLen := len(s)
-	if numberLen < 13 || numberLen > 19 {
+	if numberLen < minCardDigits || numberLen > maxCardDigits {
 		return false
 	}
 	for i := numberLen - 1; i > -1; i-- {
@@ -40,8 +40,32 @@ func TestCreditCardMasker_Mask(t *testing.T) {
             expected: []byte("Some text ****-****-****-**** and more text"),
         },
         "ValidMultipleCreditCard": {
-            input:    []byte("3530-1113-3330-0000 4012 8888 8888 18815105105105105100 "),
-            expected: []byte("****-****-****-**** **** **** **** ******************** "),
+            input:    []byte("3530-1113-3330-0000 4012 8888 8888 1881 5105105105105100 "),
+            expected: []byte("****-****-****-**** **** **** **** **** **************** "),
+        },
+        "LongerDigitRun": {
+            input:    []byte("4012 8888 8888 18815105105105105100"),
+            expected: []byte("4012 8888 8888 18815105105105105100"),
+        },
+        "ValidCreditCardExpiryDate": {
+            input:    []byte("4012-8888-8888-1881 12/25"),
+            expected: []byte("****-****-****-**** 12/25"),
+        },
+        "Valid12Digits": {
+            input:    []byte("card 5018 0000 0009"),
+            expected: []byte("card **** **** ****"),
+        },
+        "Valid19Digits": {
+            input:    []byte("card 4000 0000 0000 0000 006."),
+            expected: []byte("card **** **** **** **** ***."),
+        },
+        "Valid19DigitsNoSpaces": {
+            input:    []byte("6200000000000000000"),
+            expected: []byte("*******************"),
+        },
+        "InvalidFollowedByValid": {
+            input:    []byte("1234-5678-9012-3454 4012 8888 8888 1881"),
+            expected: []byte("1234-5678-9012-3454 **** **** **** ****"),
         },
     }
     m := masker.NewCreditCardMasker()
@@ -54,6 +78,100 @@ func TestCreditCardMasker_Mask(t *testing.T) {
     }
 }
 
+func TestCreditCardMasker_MaskChar(t *testing.T) {
+    m := &masker.CreditCardMasker{MaskChar: "X"}
+    actual, err := m.Mask(context.TODO(), []byte("card 4012-8888-8888-1881"))
+    require.NoError(t, err)
+    assert.Equal(t, "card XXXX-XXXX-XXXX-XXXX", string(actual))
+}
+
+func TestCreditCardMasker_Options(t *testing.T) {
+    testCases := map[string]struct {
+        masker   *masker.CreditCardMasker
+        input    string
+        expected string
+    }{
+        "KeepLastFour": {
+            masker:   &masker.CreditCardMasker{KeepLastFour: true},
+            input:    "card 4012-8888-8888-1881",
+            expected: "card ****-****-****-1881",
+        },
+        "KeepFirstSixAndLastFour": {
+            masker:   &masker.CreditCardMasker{KeepFirstSix: true, KeepLastFour: true, MaskChar: "X"},
+            input:    "card 4012 8888 8888 1881",
+            expected: "card 4012 88XX XXXX 1881",
+        },
+        "IdentifyVisa": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true, KeepLastFour: true},
+            input:    "card 4012888888881881.",
+            expected: "card ************1881 (Visa).",
+        },
+        "IdentifyMastercard": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "5105105105105100",
+            expected: "**************** (Mastercard)",
+        },
+        "IdentifyAmex": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "3782 822463 10005",
+            expected: "**** ****** ***** (Amex)",
+        },
+        "IdentifyDiscover": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "6011111111111117",
+            expected: "**************** (Discover)",
+        },
+        "IdentifyJCB": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "3530-1113-3330-0000",
+            expected: "****-****-****-**** (JCB)",
+        },
+        "IdentifyDinersClub": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "30569309025904",
+            expected: "************** (Diners Club)",
+        },
+        "IdentifyVisa19Digits": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true, KeepLastFour: true},
+            input:    "4000-0000-0000-0000-006",
+            expected: "****-****-****-***0-006 (Visa)",
+        },
+        "IdentifyUnionPay19Digits": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "6200000000000000000",
+            expected: "******************* (UnionPay)",
+        },
+        "IdentifyMaestro12Digits": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "501800000009",
+            expected: "************ (Maestro)",
+        },
+        "UnknownNetwork": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "9000000000000001",
+            expected: "****************",
+        },
+        "VisaWithInvalidLength": {
+            masker:   &masker.CreditCardMasker{IdentifyNetwork: true},
+            input:    "411111111111116",
+            expected: "***************",
+        },
+    }
+    for name, tc := range testCases {
+        t.Run(name, func(t *testing.T) {
+            actual, err := tc.masker.Mask(context.TODO(), []byte(tc.input))
+            require.NoError(t, err)
+            assert.Equal(t, tc.expected, string(actual))
+        })
+    }
+}
+
+func TestCreditCardMasker_CountMatches(t *testing.T) {
+    m := masker.NewCreditCardMasker()
+    text := []byte("3530-1113-3330-0000 1234-5678-9012-3454 4012 8888 8888 1881")
+    assert.Equal(t, 2, m.CountMatches(context.TODO(), text))
+}
+
 func TestNewCreditCardMasker_Name(t *testing.T) {
     m := masker.NewCreditCardMasker()
     if m.Name() != "Credit Card Masker" {
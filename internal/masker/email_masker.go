@@ -3,6 +3,9 @@ package masker
 import (
 	"context"
 	"regexp"
+	"strings"
+
+	"reverseproxy/internal/scan"
 )
 
 const emailPattern = `(?i)([A-Za-z0-9!#$%&'*+\/=?^_{|.}~-]+@(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z0-9](?:[a-z0-9-]*[a-z0-9])?)`
@@ -10,7 +13,13 @@ const emailPattern = `(?i)([A-Za-z0-9!#$%&'*+\/=?^_{|.}~-]+@(?:[a-z0-9](?:[a-z0-
 var emailRegexp = regexp.MustCompile(emailPattern)
 
 // EmailMasker ...
-type EmailMasker struct{}
+type EmailMasker struct {
+	Mode
+	// MaskChar replaces the masked characters, '*' by default
+	MaskChar string
+	// MaskDomain also masks the domain, only the top-level domain is preserved
+	MaskDomain bool
+}
 
 // NewEmailMasker creates a email masker
 func NewEmailMasker() *EmailMasker {
@@ -20,13 +29,25 @@ func NewEmailMasker() *EmailMasker {
 // Mask every email found in text, left domain intact, replace localPart with '*'
 func (em *EmailMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
 	// Replace the matched email addresses with masked values
-	maskedText := emailRegexp.ReplaceAllStringFunc(string(text), func(email string) string {
-		// Generate the masked email address
-		maskedEmail := maskEmail(email)
-		return maskedEmail
+	matches := indexPairs(emailRegexp.FindAllIndex(text, -1))
+	return replaceMatches(text, matches, func(email []byte) ([]byte, error) {
+		return em.maskEmail(ctx, string(email))
 	})
+}
+
+// CountMatches returns how many emails Mask would replace in text.
+func (em *EmailMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(emailRegexp.FindAllIndex(text, -1))
+}
 
-	return []byte(maskedText), nil
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (em *EmailMasker) ScanRules() []*scan.Rule {
+	return []*scan.Rule{{
+		Regexp: emailRegexp,
+		Replace: func(ctx context.Context, text []byte, m []int) ([]byte, error) {
+			return em.maskEmail(ctx, string(text[m[0]:m[1]]))
+		},
+	}}
 }
 
 // Name ...
@@ -34,9 +55,28 @@ func (em *EmailMasker) Name() string {
 	return "Email Masker"
 }
 
-func maskEmail(email string) string {
-	// We let a fix amount of '*' so we don't share any extra info about email length
-	return "****@" + getDomainFromEmail(email)
+func (em *EmailMasker) maskEmail(ctx context.Context, email string) ([]byte, error) {
+	mask := string(maskRune(em.MaskChar))
+	domain := getDomainFromEmail(email)
+	localPart := email[:len(email)-len(domain)-1]
+	if em.MaskDomain {
+		// Keep the dots and the top-level domain
+		lastDot := strings.LastIndexByte(domain, '.')
+		domain = strings.Map(func(r rune) rune {
+			if r == '.' {
+				return r
+			}
+			return maskRune(em.MaskChar)
+		}, domain[:lastDot]) + domain[lastDot:]
+	}
+	masked, err := em.tokenOr(ctx, "email", []byte(localPart), func() []byte {
+		// We let a fix amount of '*' so we don't share any extra info about email length
+		return []byte(strings.Repeat(mask, 4))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(masked, "@"+domain...), nil
 }
 
 func getDomainFromEmail(email string) string {
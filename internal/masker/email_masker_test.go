@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"reverseproxy/internal/masker"
+	"reverseproxy/proxy"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -72,6 +73,55 @@ func TestEmailMasker_Mask(t *testing.T) {
 	}
 }
 
+func TestEmailMasker_Options(t *testing.T) {
+	testCases := map[string]struct {
+		masker   *masker.EmailMasker
+		expected string
+	}{
+		"MaskChar": {
+			masker:   &masker.EmailMasker{MaskChar: "#"},
+			expected: "Contact ####@example.co.uk now",
+		},
+		"MaskDomain": {
+			masker:   &masker.EmailMasker{MaskDomain: true},
+			expected: "Contact ****@*******.**.uk now",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := tc.masker.Mask(context.TODO(), []byte("Contact john@example.co.uk now"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestMode_AppliesTo(t *testing.T) {
+	testCases := map[string]struct {
+		contentTypes []string
+		contentType  string
+		expected     bool
+	}{
+		"NoContentTypes":  {contentType: "image/png", expected: true},
+		"ExactMatch":      {contentTypes: []string{"application/json"}, contentType: "application/json; charset=utf-8", expected: true},
+		"PrefixMatch":     {contentTypes: []string{"text/"}, contentType: "text/html", expected: true},
+		"NoMatch":         {contentTypes: []string{"application/json", "text/"}, contentType: "image/png", expected: false},
+		"CaseInsensitive": {contentTypes: []string{"Application/JSON"}, contentType: "application/json", expected: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m := masker.Mode{ContentTypes: tc.contentTypes}
+			assert.Equal(t, tc.expected, m.AppliesTo(tc.contentType))
+		})
+	}
+}
+
+func TestEmailMasker_CountMatches(t *testing.T) {
+	m := masker.NewEmailMasker()
+	text := []byte("Send an email to john@example.com or jane@example.com, not to test@")
+	assert.Equal(t, 2, m.CountMatches(context.TODO(), text))
+}
+
 func TestEmailMasker_Name(t *testing.T) {
 	m := masker.NewEmailMasker()
 	actual := m.Name()
@@ -81,3 +131,12 @@ func TestEmailMasker_Name(t *testing.T) {
 	}
 
 }
+
+func TestRegistry(t *testing.T) {
+	m, err := proxy.NewMasker(masker.EmailType, map[string]interface{}{"MaskChar": "#"})
+	require.NoError(t, err)
+	assert.Equal(t, &masker.EmailMasker{MaskChar: "#"}, m)
+	m, err = proxy.NewMasker(masker.CreditCardType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, masker.NewCreditCardMasker(), m)
+}
@@ -0,0 +1,72 @@
+package masker
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"regexp"
+
+	"reverseproxy/internal/scan"
+)
+
+var ibanPatterns = []piiPattern{
+	{
+		re:    regexp.MustCompile(`[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?`),
+		valid: func(match []byte) bool { return validIBAN(match) },
+	},
+}
+
+// IBANMasker masks International Bank Account Numbers with a valid mod-97 checksum
+type IBANMasker struct {
+	Mode
+	// MaskChar replaces the masked characters, '*' by default
+	MaskChar string
+}
+
+// NewIBANMasker creates an IBAN masker
+func NewIBANMasker() *IBANMasker {
+	return &IBANMasker{}
+}
+
+// Mask every IBAN found in text, replace every letter and digit with '*'
+func (im *IBANMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	return im.maskPII(ctx, "iban", text, findPII(text, ibanPatterns...), maskRune(im.MaskChar))
+}
+
+// CountMatches returns how many IBANs Mask would replace in text.
+func (im *IBANMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(findPII(text, ibanPatterns...))
+}
+
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (im *IBANMasker) ScanRules() []*scan.Rule {
+	return im.piiRules("iban", maskRune(im.MaskChar), ibanPatterns...)
+}
+
+// Name ...
+func (im *IBANMasker) Name() string {
+	return "IBAN Masker"
+}
+
+// validIBAN checks the length and the ISO 7064 mod-97 checksum of iban
+func validIBAN(iban []byte) bool {
+	iban = bytes.ReplaceAll(iban, []byte(" "), nil)
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	// Move the country code and check digits to the end and turn letters into numbers, A=10 ... Z=35
+	rearranged := append(append([]byte{}, iban[4:]...), iban[:4]...)
+	var numeric []byte
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			numeric = append(numeric, c)
+		case c >= 'A' && c <= 'Z':
+			numeric = append(numeric, []byte(big.NewInt(int64(c-'A'+10)).String())...)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(string(numeric), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,50 @@
+package masker_test
+
+import (
+	"context"
+	"testing"
+
+	"reverseproxy/internal/masker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIBANMasker_Mask(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"Compact": {
+			input:    "iban DE89370400440532013000.",
+			expected: "iban **********************.",
+		},
+		"Spaced": {
+			input:    "iban GB82 WEST 1234 5698 7654 32 done",
+			expected: "iban **** **** **** **** **** ** done",
+		},
+		"InvalidChecksum": {
+			input:    "iban GB82 WEST 1234 5698 7654 33 done",
+			expected: "iban GB82 WEST 1234 5698 7654 33 done",
+		},
+		"TooShort": {
+			input:    "code AB12 3456 7890",
+			expected: "code AB12 3456 7890",
+		},
+	}
+	m := masker.NewIBANMasker()
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := m.Mask(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestIBANMasker_Name(t *testing.T) {
+	m := masker.NewIBANMasker()
+	if m.Name() != "IBAN Masker" {
+		t.Errorf("Expected: %s, Got: %s", "IBAN Masker", m.Name())
+	}
+}
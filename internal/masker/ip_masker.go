@@ -0,0 +1,74 @@
+package masker
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"regexp"
+
+	"reverseproxy/internal/scan"
+)
+
+var (
+	ipv4Pattern = piiPattern{
+		re: regexp.MustCompile(`(?:\d{1,3}\.){3}\d{1,3}`),
+		valid: func(match []byte) bool {
+			return net.ParseIP(string(match)) != nil
+		},
+	}
+	ipv6Pattern = piiPattern{
+		// Loose candidate with at least two colons, net.ParseIP has the last word
+		re: regexp.MustCompile(`(?i)[0-9a-f]*:[0-9a-f]*:(?:[0-9a-f:]*(?:\d{1,3}\.){3}\d{1,3}|[0-9a-f:]*)`),
+		valid: func(match []byte) bool {
+			// "::" alone is valid but too common in text to be an address
+			return net.ParseIP(string(match)) != nil && bytes.ContainsAny(match, "0123456789abcdefABCDEF")
+		},
+	}
+)
+
+// IPMasker masks IPv4 and IPv6 addresses
+type IPMasker struct {
+	Mode
+	// MaskChar replaces the masked characters, '*' by default
+	MaskChar string
+	// SkipIPv4 and SkipIPv6 disable masking addresses of that version
+	SkipIPv4 bool
+	SkipIPv6 bool
+}
+
+// NewIPMasker creates an IP masker
+func NewIPMasker() *IPMasker {
+	return &IPMasker{}
+}
+
+// Mask every IP address found in text, replace every digit with '*', and hex digit for IPv6
+func (ipm *IPMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	return ipm.maskPII(ctx, "ip", text, findPII(text, ipm.patterns()...), maskRune(ipm.MaskChar))
+}
+
+// CountMatches returns how many IP addresses Mask would replace in text.
+func (ipm *IPMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(findPII(text, ipm.patterns()...))
+}
+
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (ipm *IPMasker) ScanRules() []*scan.Rule {
+	return ipm.piiRules("ip", maskRune(ipm.MaskChar), ipm.patterns()...)
+}
+
+// Name ...
+func (ipm *IPMasker) Name() string {
+	return "IP Masker"
+}
+
+func (ipm *IPMasker) patterns() []piiPattern {
+	var patterns []piiPattern
+	// IPv6 goes first so IPv4-mapped addresses are masked whole
+	if !ipm.SkipIPv6 {
+		patterns = append(patterns, ipv6Pattern)
+	}
+	if !ipm.SkipIPv4 {
+		patterns = append(patterns, ipv4Pattern)
+	}
+	return patterns
+}
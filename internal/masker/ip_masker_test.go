@@ -0,0 +1,69 @@
+package masker_test
+
+import (
+	"context"
+	"testing"
+
+	"reverseproxy/internal/masker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPMasker_Mask(t *testing.T) {
+	testCases := map[string]struct {
+		masker   *masker.IPMasker
+		input    string
+		expected string
+	}{
+		"IPv4": {
+			masker:   masker.NewIPMasker(),
+			input:    "client 192.168.1.10 connected",
+			expected: "client ***.***.*.** connected",
+		},
+		"InvalidIPv4": {
+			masker:   masker.NewIPMasker(),
+			input:    "version 1.2.3.400 and 999.1.1.1",
+			expected: "version 1.2.3.400 and 999.1.1.1",
+		},
+		"IPv6": {
+			masker:   masker.NewIPMasker(),
+			input:    "client 2001:db8::ff00:42:8329, loopback ::1",
+			expected: "client ****:***::****:**:****, loopback ::*",
+		},
+		"IPv4Mapped": {
+			masker:   masker.NewIPMasker(),
+			input:    "client ::ffff:10.0.0.1",
+			expected: "client ::****:**.*.*.*",
+		},
+		"TimesAndMACs": {
+			masker:   masker.NewIPMasker(),
+			input:    "at 12:30:45 from 00:1a:2b:3c:4d:5e, empty ::",
+			expected: "at 12:30:45 from 00:1a:2b:3c:4d:5e, empty ::",
+		},
+		"SkipIPv6": {
+			masker:   &masker.IPMasker{SkipIPv6: true},
+			input:    "10.0.0.1 fe80::1",
+			expected: "**.*.*.* fe80::1",
+		},
+		"SkipIPv4": {
+			masker:   &masker.IPMasker{SkipIPv4: true},
+			input:    "10.0.0.1 fe80::1",
+			expected: "10.0.0.1 ****::*",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := tc.masker.Mask(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestIPMasker_Name(t *testing.T) {
+	m := masker.NewIPMasker()
+	if m.Name() != "IP Masker" {
+		t.Errorf("Expected: %s, Got: %s", "IP Masker", m.Name())
+	}
+}
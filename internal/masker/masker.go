@@ -0,0 +1,104 @@
+package masker
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaskChar replaces masked characters when MaskChar is not set
+const defaultMaskChar = '*'
+
+// Mode is embedded by every masker to configure when and how its result is applied.
+type Mode struct {
+	// Monitor evaluates and logs the masker but leaves the body untouched.
+	Monitor bool
+	// ContentTypes restricts the masker to responses with these media types, e.g. "application/json",
+	// or prefixes ending in "/", e.g. "text/". Every response is masked when empty.
+	ContentTypes []string
+
+	tokenizer Tokenizer
+}
+
+// Tokenizer replaces sensitive values with tokens instead of masking them.
+// Kind identifies the type of value, e.g. "email", and is part of the token.
+type Tokenizer interface {
+	Tokenize(ctx context.Context, kind string, value []byte) ([]byte, error)
+}
+
+// SetTokenizer makes the masker replace values with tokens from t, nil restores masking.
+func (m *Mode) SetTokenizer(t Tokenizer) {
+	m.tokenizer = t
+}
+
+// tokenOr returns the token of value when a tokenizer is set, the result of mask otherwise
+func (m *Mode) tokenOr(ctx context.Context, kind string, value []byte, mask func() []byte) ([]byte, error) {
+	if m.tokenizer == nil {
+		return mask(), nil
+	}
+	return m.tokenizer.Tokenize(ctx, kind, value)
+}
+
+// MonitorOnly reports whether the masker runs in monitor mode.
+func (m Mode) MonitorOnly() bool {
+	return m.Monitor
+}
+
+// AppliesTo reports whether the masker must run on a response with the given Content-Type header.
+func (m Mode) AppliesTo(contentType string) bool {
+	if len(m.ContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, ct := range m.ContentTypes {
+		ct = strings.ToLower(ct)
+		if mediaType == ct || (strings.HasSuffix(ct, "/") && strings.HasPrefix(mediaType, ct)) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskRune returns the first rune of maskChar, or defaultMaskChar when empty
+func maskRune(maskChar string) rune {
+	if maskChar == "" {
+		return defaultMaskChar
+	}
+	r, _ := utf8.DecodeRuneInString(maskChar)
+	return r
+}
+
+// replaceMatches returns text with every match, ordered index pairs, replaced with the result of replace
+func replaceMatches(text []byte, matches [][2]int, replace func(match []byte) ([]byte, error)) ([]byte, error) {
+	if len(matches) == 0 {
+		return text, nil
+	}
+	var replaced bytes.Buffer
+	replaced.Grow(len(text))
+	last := 0
+	for _, m := range matches {
+		replacement, err := replace(text[m[0]:m[1]])
+		if err != nil {
+			return nil, err
+		}
+		replaced.Write(text[last:m[0]])
+		replaced.Write(replacement)
+		last = m[1]
+	}
+	replaced.Write(text[last:])
+	return replaced.Bytes(), nil
+}
+
+// indexPairs converts the result of FindAllIndex to the index pairs used by replaceMatches
+func indexPairs(matches [][]int) [][2]int {
+	pairs := make([][2]int, 0, len(matches))
+	for _, m := range matches {
+		pairs = append(pairs, [2]int{m[0], m[1]})
+	}
+	return pairs
+}
@@ -0,0 +1,66 @@
+package masker
+
+import (
+	"context"
+	"regexp"
+
+	"reverseproxy/internal/scan"
+)
+
+var phonePatterns = []piiPattern{
+	// E.164 and international formats, e.g. +14155552671, +54 9 11 1234-5678, +44 (20) 7946 0958
+	{
+		re: regexp.MustCompile(`\+[1-9]\d{0,3}(?:[ .-]?\(?\d{1,4}\)?){1,5}[ .-]?\d{2,4}`),
+		valid: func(match []byte) bool {
+			n := len(digits(match))
+			return n >= 8 && n <= 15
+		},
+	},
+	// North American numbers, e.g. (415) 555-2671, 415-555-2671, 415.555.2671
+	{
+		re: regexp.MustCompile(`\(?[2-9]\d{2}\)?[ .-]\s?[2-9]\d{2}[ .-]\d{4}`),
+		valid: func(match []byte) bool {
+			return len(digits(match)) == 10
+		},
+	},
+	// Argentine national numbers, e.g. 011 15 1234-5678, (0351) 412-3456, 11 4321-8765
+	{
+		re: regexp.MustCompile(`\(?0?\d{2,4}\)?[ -](?:15[ -]?)?\d{3,4}-\d{4}`),
+		valid: func(match []byte) bool {
+			n := len(digits(match))
+			return n >= 10 && n <= 13
+		},
+	},
+}
+
+// PhoneMasker masks E.164, North American and Argentine phone numbers
+type PhoneMasker struct {
+	Mode
+	// MaskChar replaces the masked digits, '*' by default
+	MaskChar string
+}
+
+// NewPhoneMasker creates a phone masker
+func NewPhoneMasker() *PhoneMasker {
+	return &PhoneMasker{}
+}
+
+// Mask every phone number found in text, replace every digit with '*'
+func (pm *PhoneMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	return pm.maskPII(ctx, "phone", text, findPII(text, phonePatterns...), maskRune(pm.MaskChar))
+}
+
+// CountMatches returns how many phone numbers Mask would replace in text.
+func (pm *PhoneMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(findPII(text, phonePatterns...))
+}
+
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (pm *PhoneMasker) ScanRules() []*scan.Rule {
+	return pm.piiRules("phone", maskRune(pm.MaskChar), phonePatterns...)
+}
+
+// Name ...
+func (pm *PhoneMasker) Name() string {
+	return "Phone Masker"
+}
@@ -0,0 +1,63 @@
+package masker_test
+
+import (
+	"context"
+	"testing"
+
+	"reverseproxy/internal/masker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhoneMasker_Mask(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"E164": {
+			input:    "call +14155552671 now",
+			expected: "call +*********** now",
+		},
+		"InternationalWithSeparators": {
+			input:    "call +54 9 11 1234-5678 now",
+			expected: "call +** * ** ****-**** now",
+		},
+		"NorthAmerican": {
+			input:    "call (415) 555-2671 or 415.555.2671",
+			expected: "call (***) ***-**** or ***.***.****",
+		},
+		"ArgentineNational": {
+			input:    "call 011 15 1234-5678 or (0351) 412-3456",
+			expected: "call *** ** ****-**** or (****) ***-****",
+		},
+		"Dates": {
+			input:    "on 2023-10-18 at 10:30",
+			expected: "on 2023-10-18 at 10:30",
+		},
+		"ShortInternational": {
+			input:    "code +12 34",
+			expected: "code +12 34",
+		},
+		"PartOfALongerNumber": {
+			input:    "id 4155552671999",
+			expected: "id 4155552671999",
+		},
+	}
+	m := masker.NewPhoneMasker()
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := m.Mask(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+			assert.Equal(t, tc.input != tc.expected, m.CountMatches(context.TODO(), []byte(tc.input)) > 0)
+		})
+	}
+}
+
+func TestPhoneMasker_Name(t *testing.T) {
+	m := masker.NewPhoneMasker()
+	if m.Name() != "Phone Masker" {
+		t.Errorf("Expected: %s, Got: %s", "Phone Masker", m.Name())
+	}
+}
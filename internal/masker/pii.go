@@ -0,0 +1,124 @@
+package masker
+
+import (
+	"context"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"reverseproxy/internal/scan"
+)
+
+// piiPattern finds candidates with re and keeps the ones passing valid, which reduces
+// the false positives of the loose patterns the same way luhn does for credit cards.
+type piiPattern struct {
+	re    *regexp.Regexp
+	valid func(match []byte) bool
+	// bounded checks the text around the match at text[start:end] when set
+	bounded func(text []byte, start, end int) bool
+}
+
+// accepts reports whether the match at text[start:end] is valid and stands on its own
+func (p *piiPattern) accepts(text []byte, start, end int) bool {
+	return isolated(text, start, end) && (p.bounded == nil || p.bounded(text, start, end)) &&
+		(p.valid == nil || p.valid(text[start:end]))
+}
+
+// findPII returns the index pairs of the valid matches of every pattern, ordered and without overlaps.
+// A match glued to another letter or digit is part of a bigger token and is skipped.
+func findPII(text []byte, patterns ...piiPattern) [][2]int {
+	var found [][2]int
+	for _, p := range patterns {
+		for _, m := range p.re.FindAllIndex(text, -1) {
+			if !p.accepts(text, m[0], m[1]) {
+				continue
+			}
+			found = insertMatch(found, [2]int{m[0], m[1]})
+		}
+	}
+	return found
+}
+
+// insertMatch adds m to the ordered matches unless it overlaps one of them
+func insertMatch(matches [][2]int, m [2]int) [][2]int {
+	i := 0
+	for i < len(matches) && matches[i][1] <= m[0] {
+		i++
+	}
+	if i < len(matches) && matches[i][0] < m[1] {
+		return matches
+	}
+	matches = append(matches, [2]int{})
+	copy(matches[i+1:], matches[i:])
+	matches[i] = m
+	return matches
+}
+
+func isolated(text []byte, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRune(text[:start])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRune(text[end:])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// piiRules returns a scan rule for every pattern, replacing matches like maskPII
+func (m *Mode) piiRules(kind string, mask rune, patterns ...piiPattern) []*scan.Rule {
+	rules := make([]*scan.Rule, 0, len(patterns))
+	for i := range patterns {
+		p := &patterns[i]
+		rules = append(rules, &scan.Rule{
+			Regexp: p.re,
+			Valid:  p.accepts,
+			Replace: func(ctx context.Context, text []byte, sub []int) ([]byte, error) {
+				match := text[sub[0]:sub[1]]
+				return m.tokenOr(ctx, kind, match, func() []byte {
+					return maskAlnum(match, mask)
+				})
+			},
+		})
+	}
+	return rules
+}
+
+// maskPII replaces every match with its token, or with every letter and digit masked with mask
+// keeping separators
+func (m *Mode) maskPII(ctx context.Context, kind string, text []byte, matches [][2]int, mask rune) ([]byte, error) {
+	return replaceMatches(text, matches, func(match []byte) ([]byte, error) {
+		return m.tokenOr(ctx, kind, match, func() []byte {
+			return maskAlnum(match, mask)
+		})
+	})
+}
+
+// maskAlnum replaces every letter and digit of value with mask
+func maskAlnum(value []byte, mask rune) []byte {
+	masked := make([]byte, 0, len(value))
+	for _, r := range string(value) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			masked = utf8.AppendRune(masked, mask)
+			continue
+		}
+		masked = utf8.AppendRune(masked, r)
+	}
+	return masked
+}
+
+// digits returns the ASCII digits of b
+func digits(b []byte) []byte {
+	d := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c >= '0' && c <= '9' {
+			d = append(d, c)
+		}
+	}
+	return d
+}
@@ -0,0 +1,160 @@
+package masker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"reverseproxy/internal/scan"
+)
+
+// validators reduce false positives of RegexMasker, they receive the text that would be masked
+var validators = map[string]func(text string) bool{
+	"luhn": func(text string) bool { return luhn(onlyDigits(text)) },
+	"iban": func(text string) bool { return validIBAN([]byte(text)) },
+	"ssn":  func(text string) bool { return validSSN([]byte(text)) },
+	"cuit": func(text string) bool { return validCUIT([]byte(text)) },
+}
+
+// RegexMasker masks every match of Pattern.
+// Group selects the capture group to mask, the whole match when 0. The masked text is replaced with
+// the expansion of Replacement, which can reference groups like $1 or ${name} (written $${name} in
+// config files, where ${name} is an environment variable), or with MaskChar repeated for every
+// character when Replacement is empty.
+// Validator names a check the masked text must pass to be masked: "luhn", "iban", "ssn" or "cuit".
+type RegexMasker struct {
+	Mode
+	// Label identifies the masker in logs
+	Label       string
+	Pattern     string
+	Group       int
+	Replacement string
+	MaskChar    string
+	Validator   string
+
+	once     sync.Once
+	re       *regexp.Regexp
+	validate func(string) bool
+	err      error
+}
+
+// NewRegexMasker creates a regex masker for pattern, replacing every character of the match with '*'
+func NewRegexMasker(label, pattern string) (*RegexMasker, error) {
+	rm := &RegexMasker{Label: label, Pattern: pattern}
+	return rm, rm.Compile()
+}
+
+// Compile validates and compiles the pattern, it is called lazily by Mask.
+func (rm *RegexMasker) Compile() error {
+	rm.once.Do(func() {
+		rm.re, rm.err = regexp.Compile(rm.Pattern)
+		if rm.err != nil {
+			return
+		}
+		if rm.Group < 0 || rm.Group > rm.re.NumSubexp() {
+			rm.err = fmt.Errorf("group %d not in pattern %q", rm.Group, rm.Pattern)
+			return
+		}
+		if rm.Validator != "" {
+			validate, ok := validators[rm.Validator]
+			if !ok {
+				rm.err = fmt.Errorf("unknown validator %q", rm.Validator)
+				return
+			}
+			rm.validate = validate
+		}
+	})
+	return rm.err
+}
+
+// Mask every match of the pattern that passes the validator
+func (rm *RegexMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	if err := rm.Compile(); err != nil {
+		return nil, err
+	}
+	matches := rm.matches(text)
+	if len(matches) == 0 {
+		return text, nil
+	}
+	var masked bytes.Buffer
+	masked.Grow(len(text))
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*rm.Group], m[2*rm.Group+1]
+		replacement, err := rm.replace(ctx, text, m)
+		if err != nil {
+			return nil, err
+		}
+		masked.Write(text[last:start])
+		masked.Write(replacement)
+		last = end
+	}
+	masked.Write(text[last:])
+	return masked.Bytes(), nil
+}
+
+// ScanRules returns the pattern of the masker for the single pass scan engine, it is empty when the
+// pattern is invalid.
+func (rm *RegexMasker) ScanRules() []*scan.Rule {
+	if err := rm.Compile(); err != nil {
+		return nil
+	}
+	rule := &scan.Rule{Regexp: rm.re, Group: rm.Group, Replace: rm.replace}
+	if rm.validate != nil {
+		rule.Valid = func(text []byte, start, end int) bool {
+			return rm.validate(string(text[start:end]))
+		}
+	}
+	return []*scan.Rule{rule}
+}
+
+// replace returns the replacement of the match with submatch indexes m
+func (rm *RegexMasker) replace(ctx context.Context, text []byte, m []int) ([]byte, error) {
+	kind := rm.Label
+	if kind == "" {
+		kind = "regex"
+	}
+	start, end := m[2*rm.Group], m[2*rm.Group+1]
+	return rm.tokenOr(ctx, kind, text[start:end], func() []byte {
+		if rm.Replacement != "" {
+			return rm.re.Expand(nil, []byte(rm.Replacement), text, m)
+		}
+		return []byte(strings.Repeat(string(maskRune(rm.MaskChar)), utf8.RuneCount(text[start:end])))
+	})
+}
+
+// CountMatches returns how many values Mask would replace in text.
+func (rm *RegexMasker) CountMatches(ctx context.Context, text []byte) int {
+	if err := rm.Compile(); err != nil {
+		return 0
+	}
+	return len(rm.matches(text))
+}
+
+// matches returns the submatch indexes of every match with the masked group present and valid
+func (rm *RegexMasker) matches(text []byte) [][]int {
+	var valid [][]int
+	for _, m := range rm.re.FindAllSubmatchIndex(text, -1) {
+		start, end := m[2*rm.Group], m[2*rm.Group+1]
+		if start < 0 {
+			continue
+		}
+		if rm.validate != nil && !rm.validate(string(text[start:end])) {
+			continue
+		}
+		valid = append(valid, m)
+	}
+	return valid
+}
+
+// Name ...
+func (rm *RegexMasker) Name() string {
+	if rm.Label == "" {
+		return "Regex Masker"
+	}
+	return "Regex Masker (" + rm.Label + ")"
+}
@@ -0,0 +1,89 @@
+package masker_test
+
+import (
+	"context"
+	"testing"
+
+	"reverseproxy/internal/masker"
+	"reverseproxy/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexMasker_Mask(t *testing.T) {
+	testCases := map[string]struct {
+		masker   *masker.RegexMasker
+		input    string
+		expected string
+	}{
+		"WholeMatch": {
+			masker:   &masker.RegexMasker{Pattern: `EMP-\d{6}`},
+			input:    "employee EMP-123456 and EMP-654321",
+			expected: "employee ********** and **********",
+		},
+		"CaptureGroup": {
+			masker:   &masker.RegexMasker{Pattern: `sk_live_([A-Za-z0-9]+)`, Group: 1, MaskChar: "x"},
+			input:    `{"key": "sk_live_4eC39HqLyjWDarjtT1"}`,
+			expected: `{"key": "sk_live_xxxxxxxxxxxxxxxxxx"}`,
+		},
+		"Replacement": {
+			masker:   &masker.RegexMasker{Pattern: `acct-(\d+)-(\d{4})`, Replacement: "acct-XXXX-$2"},
+			input:    "account acct-99887766-4321",
+			expected: "account acct-XXXX-4321",
+		},
+		"NamedGroupReplacement": {
+			masker:   &masker.RegexMasker{Pattern: `user=(?P<user>\w+)`, Group: 1, Replacement: "[${user}]"},
+			input:    "user=alice",
+			expected: "user=[alice]",
+		},
+		"Validator": {
+			masker:   &masker.RegexMasker{Pattern: `\b\d{16}\b`, Validator: "luhn", MaskChar: "#"},
+			input:    "5105105105105100 1234567890123456",
+			expected: "################ 1234567890123456",
+		},
+		"NoMatch": {
+			masker:   &masker.RegexMasker{Pattern: `EMP-\d{6}`},
+			input:    "nothing to mask",
+			expected: "nothing to mask",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := tc.masker.Mask(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestRegexMasker_Compile(t *testing.T) {
+	assert.Error(t, (&masker.RegexMasker{Pattern: `(`}).Compile())
+	assert.Error(t, (&masker.RegexMasker{Pattern: `a(b)`, Group: 2}).Compile())
+	assert.Error(t, (&masker.RegexMasker{Pattern: `a`, Validator: "unknown"}).Compile())
+	_, err := masker.NewRegexMasker("employee", `EMP-\d+`)
+	assert.NoError(t, err)
+}
+
+func TestRegexMasker_CountMatches(t *testing.T) {
+	m := &masker.RegexMasker{Pattern: `\b\d{16}\b`, Validator: "luhn"}
+	assert.Equal(t, 1, m.CountMatches(context.TODO(), []byte("5105105105105100 1234567890123456")))
+}
+
+func TestRegexMasker_Registry(t *testing.T) {
+	m, err := proxy.NewMasker(masker.RegexType, map[string]interface{}{
+		"Label":   "employee",
+		"Pattern": `EMP-\d+`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Regex Masker (employee)", m.Name())
+	_, err = proxy.NewMasker(masker.RegexType, map[string]interface{}{"Pattern": `(`})
+	assert.Error(t, err)
+}
+
+func TestRegexMasker_Name(t *testing.T) {
+	m := &masker.RegexMasker{}
+	if m.Name() != "Regex Masker" {
+		t.Errorf("Expected: %s, Got: %s", "Regex Masker", m.Name())
+	}
+}
@@ -0,0 +1,44 @@
+package masker
+
+import "reverseproxy/proxy"
+
+// Types of the built-in maskers in the proxy registry
+const (
+	EmailType       = "email"
+	CreditCardType  = "credit_card"
+	RegexType       = "regex"
+	PhoneType       = "phone"
+	IBANType        = "iban"
+	SSNType         = "ssn"
+	ArgentineIDType = "argentine_id"
+	IPType          = "ip"
+	SecretType      = "secret"
+)
+
+func init() {
+	register(EmailType, func() proxy.Masker { return NewEmailMasker() })
+	register(CreditCardType, func() proxy.Masker { return NewCreditCardMasker() })
+	register(RegexType, func() proxy.Masker { return &RegexMasker{} })
+	register(PhoneType, func() proxy.Masker { return NewPhoneMasker() })
+	register(IBANType, func() proxy.Masker { return NewIBANMasker() })
+	register(SSNType, func() proxy.Masker { return NewSSNMasker() })
+	register(ArgentineIDType, func() proxy.Masker { return NewArgentineIDMasker() })
+	register(IPType, func() proxy.Masker { return NewIPMasker() })
+	register(SecretType, func() proxy.Masker { return NewSecretMasker() })
+}
+
+// register a factory decoding the options into the masker returned by newMasker
+func register(typeName string, newMasker func() proxy.Masker) {
+	proxy.RegisterMasker(typeName, func(options map[string]interface{}) (proxy.Masker, error) {
+		m := newMasker()
+		if err := proxy.DecodeOptions(options, m); err != nil {
+			return nil, err
+		}
+		if c, ok := m.(interface{ Compile() error }); ok {
+			if err := c.Compile(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	})
+}
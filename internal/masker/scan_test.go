@@ -0,0 +1,221 @@
+package masker_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"reverseproxy/internal/masker"
+	"reverseproxy/internal/scan"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scanMasker interface {
+	Mask(ctx context.Context, text []byte) ([]byte, error)
+	ScanRules() []*scan.Rule
+}
+
+// record is a JSON record with a value of every masker and numbers that are not cards
+const record = `{"id": 1234567, "name": "John Doe", "email": "john.doe@example.com", ` +
+	`"card": "4012 8888 8888 1881", "order": "ORD-2023-000042", "phone": "+14155552671", ` +
+	`"iban": "GB82 WEST 1234 5698 7654 32", "ssn": "123-45-6789", "cuit": "20-12345678-6", ` +
+	`"ip": "192.168.10.1", "ipv6": "2001:db8::ff00:42:8329", "token": "Bearer abcdefghijklmnopqrstuvwxyz012345", ` +
+	`"notes": "lorem ipsum dolor sit amet, consectetur adipiscing elit"}` + "\n"
+
+// body returns size bytes of records
+func body(size int) []byte {
+	b := bytes.Repeat([]byte(record), size/len(record)+1)
+	return b[:size]
+}
+
+func scanMaskers(t testing.TB) []scanMasker {
+	regex, err := masker.NewRegexMasker("order", `order": "([\w-]+)"`)
+	require.NoError(t, err)
+	regex.Group = 1
+	return []scanMasker{
+		masker.NewEmailMasker(),
+		&masker.CreditCardMasker{KeepLastFour: true, IdentifyNetwork: true},
+		masker.NewPhoneMasker(),
+		masker.NewIBANMasker(),
+		masker.NewSSNMasker(),
+		masker.NewArgentineIDMasker(),
+		masker.NewIPMasker(),
+		masker.NewSecretMasker(),
+		regex,
+	}
+}
+
+func TestScanRules(t *testing.T) {
+	// Alone, every masker must mask the same with the scan engine
+	text := body(4 * len(record))
+	for _, m := range scanMaskers(t) {
+		t.Run(fmt.Sprintf("%T", m), func(t *testing.T) {
+			expected, err := m.Mask(context.TODO(), text)
+			require.NoError(t, err)
+			masked, err := scan.New(m.ScanRules()...).Replace(context.TODO(), text)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(masked))
+		})
+	}
+}
+
+func TestScanRules_Chain(t *testing.T) {
+	var rules []*scan.Rule
+	for _, m := range scanMaskers(t) {
+		rules = append(rules, m.ScanRules()...)
+	}
+	masked, err := scan.New(rules...).Replace(context.TODO(), []byte(record))
+	require.NoError(t, err)
+	expected := `{"id": 1234567, "name": "John Doe", "email": "****@example.com", ` +
+		`"card": "**** **** **** 1881 (Visa)", "order": "***************", "phone": "+***********", ` +
+		`"iban": "**** **** **** **** **** **", "ssn": "***-**-****", "cuit": "**-********-*", ` +
+		`"ip": "***.***.**.*", "ipv6": "****:***::****:**:****", "token": "Bearer [REDACTED]", ` +
+		`"notes": "lorem ipsum dolor sit amet, consectetur adipiscing elit"}` + "\n"
+	assert.Equal(t, expected, string(masked))
+}
+
+var benchmarkSizes = []struct {
+	name string
+	size int
+}{
+	{"1KB", 1 << 10},
+	{"1MB", 1 << 20},
+	{"100MB", 100 << 20},
+}
+
+// BenchmarkMask_Baseline runs the email and credit card maskers of the proxy before the scan engine,
+// which converted the body to a string for every masker
+func BenchmarkMask_Baseline(b *testing.B) {
+	benchmarkChain(b, []func(context.Context, []byte) ([]byte, error){baselineMaskEmail, baselineMaskCreditCard})
+}
+
+// BenchmarkMask_BaselineScan runs the maskers of BenchmarkMask_Baseline with the scan engine
+func BenchmarkMask_BaselineScan(b *testing.B) {
+	benchmarkScan(b, []scanMasker{masker.NewEmailMasker(), masker.NewCreditCardMasker()})
+}
+
+// BenchmarkMask_Chain runs every masker after the other, as the proxy did before the scan engine
+func BenchmarkMask_Chain(b *testing.B) {
+	var maskers []func(context.Context, []byte) ([]byte, error)
+	for _, m := range scanMaskers(b) {
+		maskers = append(maskers, m.Mask)
+	}
+	benchmarkChain(b, maskers)
+}
+
+func BenchmarkMask_Scan(b *testing.B) {
+	benchmarkScan(b, scanMaskers(b))
+}
+
+func benchmarkChain(b *testing.B, maskers []func(context.Context, []byte) ([]byte, error)) {
+	for _, bs := range benchmarkSizes {
+		b.Run(bs.name, func(b *testing.B) {
+			if bs.size > 1<<20 && testing.Short() {
+				b.Skip("skipping large body in short mode")
+			}
+			text := body(bs.size)
+			b.SetBytes(int64(bs.size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				masked := text
+				for _, mask := range maskers {
+					var err error
+					if masked, err = mask(context.TODO(), masked); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func benchmarkScan(b *testing.B, maskers []scanMasker) {
+	var rules []*scan.Rule
+	for _, m := range maskers {
+		rules = append(rules, m.ScanRules()...)
+	}
+	// The proxy builds the engine once for every configuration
+	engine := scan.New(rules...)
+	for _, bs := range benchmarkSizes {
+		b.Run(bs.name, func(b *testing.B) {
+			if bs.size > 1<<20 && testing.Short() {
+				b.Skip("skipping large body in short mode")
+			}
+			text := body(bs.size)
+			b.SetBytes(int64(bs.size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := engine.Replace(context.TODO(), text); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// The maskers below are the ones of the proxy before the scan engine, kept as they were to
+// benchmark against
+
+var (
+	baselineEmailRegexp = regexp.MustCompile(`(?i)([A-Za-z0-9!#$%&'*+\/=?^_{|.}~-]+@` +
+		`(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z0-9](?:[a-z0-9-]*[a-z0-9])?)`)
+	baselineCreditCardRegexp = regexp.MustCompile(`(?:\d[ -]*?){13,16}`)
+)
+
+func baselineMaskEmail(ctx context.Context, text []byte) ([]byte, error) {
+	maskedText := baselineEmailRegexp.ReplaceAllStringFunc(string(text), func(email string) string {
+		return "****@" + email[strings.IndexByte(email, '@')+1:]
+	})
+	return []byte(maskedText), nil
+}
+
+func baselineMaskCreditCard(ctx context.Context, text []byte) ([]byte, error) {
+	maskedText := baselineCreditCardRegexp.ReplaceAllStringFunc(string(text), func(cc string) string {
+		var onlyDigits strings.Builder
+		for _, r := range cc {
+			if r >= '0' && r <= '9' {
+				onlyDigits.WriteRune(r)
+			}
+		}
+		if !baselineLuhn(onlyDigits.String()) {
+			return cc
+		}
+		maskedCC := ""
+		for i := 0; i < len(cc); i++ {
+			if cc[i] < '0' || cc[i] > '9' {
+				maskedCC += string(cc[i])
+				continue
+			}
+			maskedCC += "*"
+		}
+		return maskedCC
+	})
+	return []byte(maskedText), nil
+}
+
+func baselineLuhn(s string) bool {
+	var sum int
+	var alternate bool
+	numberLen := len(s)
+	if numberLen < 13 || numberLen > 19 {
+		return false
+	}
+	for i := numberLen - 1; i > -1; i-- {
+		mod, _ := strconv.Atoi(string(s[i]))
+		if alternate {
+			mod *= 2
+			if mod > 9 {
+				mod = (mod % 10) + 1
+			}
+		}
+		alternate = !alternate
+		sum += mod
+	}
+	return sum%10 == 0
+}
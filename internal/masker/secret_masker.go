@@ -0,0 +1,282 @@
+package masker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+
+	"reverseproxy/internal/scan"
+)
+
+const (
+	defaultEntropyThreshold = 3.5
+	defaultRedaction        = "[REDACTED]"
+	// shortValueEntropy is the share of the highest entropy of its length a value needs when it is
+	// too short to reach the threshold: n characters have at most log2(n) bits per character
+	shortValueEntropy = 0.85
+	// minEntropyValue is the length of the shortest value redacted for its entropy
+	minEntropyValue = 6
+)
+
+// secretRule finds a kind of secret, group selects the part of the match to redact
+type secretRule struct {
+	re    *regexp.Regexp
+	group int
+	valid func(sm *SecretMasker, secret []byte) bool
+}
+
+// secretRules are the rules SecretMasker can enable by name
+var secretRules = map[string]secretRule{
+	"jwt": {
+		re:    regexp.MustCompile(`eyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`),
+		valid: func(sm *SecretMasker, secret []byte) bool { return validJWTHeader(secret) },
+	},
+	"aws_access_key": {
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	},
+	"private_key": {
+		re: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z]+ )*PRIVATE KEY-----`),
+	},
+	"bearer_token": {
+		re:    regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{16,}=*)`),
+		group: 1,
+	},
+	"github_token": {
+		re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	},
+	"slack_token": {
+		re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),
+	},
+	"keyword_entropy": {
+		// The keywords start a word or follow an underscore, e.g. client_secret but not mytoken
+		re:    regexp.MustCompile(`(?i)(?:\b|_)(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|token)["']?\s*[:=]\s*["']?([^\s"',;&}]+)`),
+		group: 1,
+		valid: func(sm *SecretMasker, secret []byte) bool { return sm.highEntropy(secret) },
+	},
+}
+
+// defaultSecretRules is every rule, private keys first so whole PEM blocks win over the tokens
+// they may contain
+var defaultSecretRules = []string{"private_key", "jwt", "aws_access_key", "github_token", "slack_token",
+	"bearer_token", "keyword_entropy"}
+
+// SecretMasker redacts credentials backends leak in responses: JWTs, AWS access keys, private key
+// PEM blocks, bearer tokens, GitHub and Slack tokens, and high-entropy values next to words like
+// password or secret.
+// Rules enables rules by name, all of them when empty. EntropyThreshold is the minimum Shannon
+// entropy in bits per character of a keyword_entropy value, 3.5 by default. Values too short to
+// reach it need 85% of the highest entropy of their length instead, e.g. 2.94 bits for 11 characters.
+type SecretMasker struct {
+	Mode
+	Rules            []string
+	EntropyThreshold float64
+	// CustomRules are added to the enabled rules
+	CustomRules []SecretRule
+	// Redaction replaces every secret, "[REDACTED]" by default
+	Redaction string
+
+	once  sync.Once
+	rules []secretRule
+	err   error
+}
+
+// SecretRule is a user-defined rule of SecretMasker. It redacts the matches of Pattern, or the
+// values following one of Keywords like keyword_entropy does, e.g. "pin: 1234" for the keyword pin.
+type SecretRule struct {
+	// Name identifies the rule in errors
+	Name    string
+	Pattern string
+	// Group selects the capture group of Pattern to redact, the whole match when 0
+	Group    int
+	Keywords []string
+	// Entropy redacts only the values of at least 6 characters reaching the entropy threshold of
+	// the masker
+	Entropy bool
+}
+
+// compile returns the rule SecretMasker runs
+func (r *SecretRule) compile() (secretRule, error) {
+	if (r.Pattern == "") == (len(r.Keywords) == 0) {
+		return secretRule{}, fmt.Errorf("secret rule %q needs either a pattern or keywords", r.Name)
+	}
+	pattern, group := r.Pattern, r.Group
+	if len(r.Keywords) > 0 {
+		quoted := make([]string, len(r.Keywords))
+		for i, k := range r.Keywords {
+			quoted[i] = regexp.QuoteMeta(k)
+		}
+		pattern = `(?i)\b(?:` + strings.Join(quoted, "|") + `)["']?\s*[:=]\s*["']?([^\s"',;&}]+)`
+		group = 1
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return secretRule{}, fmt.Errorf("secret rule %q: %w", r.Name, err)
+	}
+	if group < 0 || group > re.NumSubexp() {
+		return secretRule{}, fmt.Errorf("secret rule %q: group %d not in pattern %q", r.Name, group, pattern)
+	}
+	rule := secretRule{re: re, group: group}
+	if r.Entropy {
+		rule.valid = func(sm *SecretMasker, secret []byte) bool { return sm.highEntropy(secret) }
+	}
+	return rule, nil
+}
+
+// NewSecretMasker creates a secret masker with every rule enabled
+func NewSecretMasker() *SecretMasker {
+	return &SecretMasker{}
+}
+
+// Compile validates the rule names and compiles the custom rules, it is called lazily by Mask.
+func (sm *SecretMasker) Compile() error {
+	sm.once.Do(func() {
+		names := sm.Rules
+		if len(names) == 0 {
+			names = defaultSecretRules
+		}
+		for _, name := range names {
+			rule, ok := secretRules[name]
+			if !ok {
+				sm.err = fmt.Errorf("unknown secret rule %q", name)
+				return
+			}
+			sm.rules = append(sm.rules, rule)
+		}
+		for i := range sm.CustomRules {
+			rule, err := sm.CustomRules[i].compile()
+			if err != nil {
+				sm.err = err
+				return
+			}
+			sm.rules = append(sm.rules, rule)
+		}
+	})
+	return sm.err
+}
+
+// Mask every secret found in text, replace it with the redaction
+func (sm *SecretMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	if err := sm.Compile(); err != nil {
+		return nil, err
+	}
+	return replaceMatches(text, sm.find(text), func(secret []byte) ([]byte, error) {
+		return sm.replace(ctx, secret)
+	})
+}
+
+// ScanRules returns the patterns of the enabled rules for the single pass scan engine, it is empty
+// when a rule name is unknown.
+func (sm *SecretMasker) ScanRules() []*scan.Rule {
+	if err := sm.Compile(); err != nil {
+		return nil
+	}
+	rules := make([]*scan.Rule, 0, len(sm.rules))
+	for _, rule := range sm.rules {
+		rule := rule
+		r := &scan.Rule{
+			Regexp: rule.re,
+			Group:  rule.group,
+			Replace: func(ctx context.Context, text []byte, m []int) ([]byte, error) {
+				return sm.replace(ctx, text[m[2*rule.group]:m[2*rule.group+1]])
+			},
+		}
+		if rule.valid != nil {
+			r.Valid = func(text []byte, start, end int) bool {
+				return rule.valid(sm, text[start:end])
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func (sm *SecretMasker) replace(ctx context.Context, secret []byte) ([]byte, error) {
+	return sm.tokenOr(ctx, "secret", secret, func() []byte {
+		if sm.Redaction == "" {
+			return []byte(defaultRedaction)
+		}
+		return []byte(sm.Redaction)
+	})
+}
+
+// CountMatches returns how many secrets Mask would replace in text.
+func (sm *SecretMasker) CountMatches(ctx context.Context, text []byte) int {
+	if err := sm.Compile(); err != nil {
+		return 0
+	}
+	return len(sm.find(text))
+}
+
+// Name ...
+func (sm *SecretMasker) Name() string {
+	return "Secret Masker"
+}
+
+func (sm *SecretMasker) find(text []byte) [][2]int {
+	var found [][2]int
+	for _, rule := range sm.rules {
+		for _, m := range rule.re.FindAllSubmatchIndex(text, -1) {
+			start, end := m[2*rule.group], m[2*rule.group+1]
+			if start < 0 || (rule.valid != nil && !rule.valid(sm, text[start:end])) {
+				continue
+			}
+			found = insertMatch(found, [2]int{start, end})
+		}
+	}
+	return found
+}
+
+func (sm *SecretMasker) threshold() float64 {
+	if sm.EntropyThreshold > 0 {
+		return sm.EntropyThreshold
+	}
+	return defaultEntropyThreshold
+}
+
+// highEntropy reports whether secret reaches the entropy threshold, or most of the highest entropy
+// of its length when it is too short to reach it
+func (sm *SecretMasker) highEntropy(secret []byte) bool {
+	if len(secret) < minEntropyValue {
+		return false
+	}
+	threshold := sm.threshold()
+	if short := shortValueEntropy * math.Log2(float64(len(secret))); short < threshold {
+		threshold = short
+	}
+	return entropy(secret) >= threshold
+}
+
+// validJWTHeader checks the first segment of a JWT decodes to a JSON header with an algorithm
+func validJWTHeader(jwt []byte) bool {
+	header, _, _ := bytes.Cut(jwt, []byte("."))
+	decoded, err := base64.RawURLEncoding.DecodeString(string(header))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(decoded, []byte(`"alg"`))
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s []byte) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, c := range s {
+		counts[c]++
+	}
+	var h float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(s))
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,57 @@
+package masker
+
+import (
+	"context"
+	"regexp"
+
+	"reverseproxy/internal/scan"
+)
+
+var ssnPatterns = []piiPattern{
+	{
+		re:    regexp.MustCompile(`\d{3}-\d{2}-\d{4}`),
+		valid: func(match []byte) bool { return validSSN(match) },
+	},
+}
+
+// SSNMasker masks US Social Security Numbers written as AAA-GG-SSSS
+type SSNMasker struct {
+	Mode
+	// MaskChar replaces the masked digits, '*' by default
+	MaskChar string
+}
+
+// NewSSNMasker creates a SSN masker
+func NewSSNMasker() *SSNMasker {
+	return &SSNMasker{}
+}
+
+// Mask every SSN found in text, replace every digit with '*'
+func (sm *SSNMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
+	return sm.maskPII(ctx, "ssn", text, findPII(text, ssnPatterns...), maskRune(sm.MaskChar))
+}
+
+// CountMatches returns how many SSNs Mask would replace in text.
+func (sm *SSNMasker) CountMatches(ctx context.Context, text []byte) int {
+	return len(findPII(text, ssnPatterns...))
+}
+
+// ScanRules returns the patterns of the masker for the single pass scan engine.
+func (sm *SSNMasker) ScanRules() []*scan.Rule {
+	return sm.piiRules("ssn", maskRune(sm.MaskChar), ssnPatterns...)
+}
+
+// Name ...
+func (sm *SSNMasker) Name() string {
+	return "SSN Masker"
+}
+
+// validSSN rejects the numbers never issued: area 000, 666 or 9xx, group 00 and serial 0000
+func validSSN(ssn []byte) bool {
+	d := string(digits(ssn))
+	if len(d) != 9 {
+		return false
+	}
+	area, group, serial := d[:3], d[3:5], d[5:]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
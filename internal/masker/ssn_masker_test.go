@@ -0,0 +1,42 @@
+package masker_test
+
+import (
+	"context"
+	"testing"
+
+	"reverseproxy/internal/masker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSNMasker_Mask(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"Valid":         {input: "ssn 123-45-6789.", expected: "ssn ***-**-****."},
+		"AreaZero":      {input: "ssn 000-45-6789", expected: "ssn 000-45-6789"},
+		"Area666":       {input: "ssn 666-45-6789", expected: "ssn 666-45-6789"},
+		"Area9xx":       {input: "ssn 912-45-6789", expected: "ssn 912-45-6789"},
+		"GroupZero":     {input: "ssn 123-00-6789", expected: "ssn 123-00-6789"},
+		"SerialZero":    {input: "ssn 123-45-0000", expected: "ssn 123-45-0000"},
+		"LongerNumber":  {input: "ref 1123-45-6789", expected: "ref 1123-45-6789"},
+		"MultipleValid": {input: "123-45-6789,234-56-7890", expected: "***-**-****,***-**-****"},
+	}
+	m := masker.NewSSNMasker()
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := m.Mask(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestSSNMasker_Name(t *testing.T) {
+	m := masker.NewSSNMasker()
+	if m.Name() != "SSN Masker" {
+		t.Errorf("Expected: %s, Got: %s", "SSN Masker", m.Name())
+	}
+}
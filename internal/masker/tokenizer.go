@@ -0,0 +1,40 @@
+package masker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MinTokenLength is the shortest number of hex characters of a token, shorter tokens of different
+// values collide too often to be detokenized
+const MinTokenLength = 12
+
+// HMACTokenizer derives stable tokens from a keyed HMAC-SHA256 of the value, the same value always
+// maps to the same token, e.g. "email_3f9a1c0b7d2e", but the value can not be recovered from it.
+type HMACTokenizer struct {
+	Secret string
+	// Length is the number of hex characters of the token, between MinTokenLength, the default, and 64
+	Length int
+}
+
+// NewHMACTokenizer creates a tokenizer keyed with secret
+func NewHMACTokenizer(secret string, length int) *HMACTokenizer {
+	return &HMACTokenizer{Secret: secret, Length: length}
+}
+
+// Tokenize returns kind_<hmac> for value, the kind is part of the HMAC input so equal values
+// of different kinds get different tokens
+func (t *HMACTokenizer) Tokenize(ctx context.Context, kind string, value []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, []byte(t.Secret))
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write(value)
+	sum := hex.EncodeToString(mac.Sum(nil))
+	length := t.Length
+	if length < MinTokenLength || length > len(sum) {
+		length = MinTokenLength
+	}
+	return []byte(kind + "_" + sum[:length]), nil
+}
@@ -0,0 +1,341 @@
+package masker
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultVaultMaxEntries is the number of entries a vault keeps when VaultLimits.MaxEntries is 0
+const DefaultVaultMaxEntries = 100000
+
+// vaultHeader starts the vault files whose entries have the time they were stored
+const vaultHeader = "# reverseproxy vault v2"
+
+// vaultCompactSlack is the number of lines of dropped entries a vault file can have before it is
+// compacted while the proxy runs
+const vaultCompactSlack = 1024
+
+// ErrTokenCollision is returned when a token is stored with another value than the one it keeps,
+// e.g. when a short token Length makes the tokens of two values collide
+var ErrTokenCollision = errors.New("token already stores another value")
+
+// Vault stores the original values of tokens so authorized clients can get them back.
+type Vault interface {
+	Store(ctx context.Context, token string, value []byte) error
+	Load(ctx context.Context, token string) ([]byte, bool, error)
+}
+
+// VaultLimits bound the entries a vault keeps, the oldest ones are dropped first.
+type VaultLimits struct {
+	// MaxEntries is the number of entries kept, DefaultVaultMaxEntries when 0
+	MaxEntries int
+	// TTL drops the entries stored longer ago, entries never expire when 0
+	TTL time.Duration
+}
+
+func (l VaultLimits) maxEntries() int {
+	if l.MaxEntries > 0 {
+		return l.MaxEntries
+	}
+	return DefaultVaultMaxEntries
+}
+
+// MemoryVault keeps the values in memory, they are lost when the process exits.
+// Storing a known token again keeps its first stored time.
+type MemoryVault struct {
+	limits VaultLimits
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order has the *vaultEntry values from the oldest to the most recently stored
+	order *list.List
+}
+
+type vaultEntry struct {
+	token  string
+	value  []byte
+	stored time.Time
+}
+
+// NewMemoryVault creates an empty in-memory vault bounded by limits
+func NewMemoryVault(limits VaultLimits) *MemoryVault {
+	return &MemoryVault{limits: limits, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Store the value of token, it fails with ErrTokenCollision when token keeps another value
+func (mv *MemoryVault) Store(ctx context.Context, token string, value []byte) error {
+	return mv.add(token, value, time.Now(), false)
+}
+
+// Load the value of token
+func (mv *MemoryVault) Load(ctx context.Context, token string) ([]byte, bool, error) {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+	el, ok := mv.entries[token]
+	if !ok {
+		return nil, false, nil
+	}
+	if e := el.Value.(*vaultEntry); mv.expired(e, time.Now()) {
+		mv.remove(el)
+		return nil, false, nil
+	}
+	return el.Value.(*vaultEntry).value, true, nil
+}
+
+// Len returns the number of entries kept
+func (mv *MemoryVault) Len() int {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+	return mv.order.Len()
+}
+
+// add keeps the value of token stored at the given time, a known token is renewed when renew is set
+// and fails with ErrTokenCollision otherwise if it keeps another value
+func (mv *MemoryVault) add(token string, value []byte, stored time.Time, renew bool) error {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+	if el, ok := mv.entries[token]; ok {
+		e := el.Value.(*vaultEntry)
+		switch {
+		case renew:
+			e.value, e.stored = append([]byte(nil), value...), stored
+			mv.order.MoveToBack(el)
+			return nil
+		case mv.expired(e, time.Now()):
+			mv.remove(el)
+		case !bytes.Equal(e.value, value):
+			return fmt.Errorf("%w: %s", ErrTokenCollision, token)
+		default:
+			return nil
+		}
+	}
+	mv.entries[token] = mv.order.PushBack(&vaultEntry{token: token, value: append([]byte(nil), value...), stored: stored})
+	mv.evict(time.Now())
+	return nil
+}
+
+// evict drops the oldest entries beyond the limits
+func (mv *MemoryVault) evict(now time.Time) {
+	for el := mv.order.Front(); el != nil; el = mv.order.Front() {
+		if mv.order.Len() <= mv.limits.maxEntries() && !mv.expired(el.Value.(*vaultEntry), now) {
+			return
+		}
+		mv.remove(el)
+	}
+}
+
+func (mv *MemoryVault) expired(e *vaultEntry, now time.Time) bool {
+	return mv.limits.TTL > 0 && now.Sub(e.stored) >= mv.limits.TTL
+}
+
+func (mv *MemoryVault) remove(el *list.Element) {
+	mv.order.Remove(el)
+	delete(mv.entries, el.Value.(*vaultEntry).token)
+}
+
+// each calls fn with the entries kept, from the oldest one
+func (mv *MemoryVault) each(fn func(e *vaultEntry) error) error {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+	mv.evict(time.Now())
+	for el := mv.order.Front(); el != nil; el = el.Next() {
+		if err := fn(el.Value.(*vaultEntry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileVault is a MemoryVault persisted to an append-only file, one "token value stored" line per
+// entry with the value base64 encoded and the time it was stored in Unix seconds. The file is
+// created with 0600 permissions since it holds the original sensitive values, and it is rewritten
+// with the entries kept when it is opened and when the dropped ones pile up.
+type FileVault struct {
+	*MemoryVault
+	path string
+	mu   sync.Mutex
+	file *os.File
+	// lines is the number of entries in the file
+	lines int
+}
+
+// OpenFileVault opens or creates the vault file at path and loads the entries within limits.
+// Files without stored times are loaded as if their entries were stored when opened.
+func OpenFileVault(path string, limits VaultLimits) (*FileVault, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fv := &FileVault{MemoryVault: NewMemoryVault(limits), path: path}
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	versioned := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 1 && text == vaultHeader {
+			versioned = true
+			continue
+		}
+		token, value, stored, err := parseVaultEntry(text, versioned)
+		if err != nil {
+			return nil, fmt.Errorf("vault %s: invalid entry at line %d", path, line)
+		}
+		if stored.IsZero() {
+			stored = now
+		}
+		_ = fv.add(token, value, stored, true)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := fv.compact(); err != nil {
+		return nil, err
+	}
+	return fv, nil
+}
+
+// parseVaultEntry parses a line of the vault file, the stored time is zero without versioned
+func parseVaultEntry(text string, versioned bool) (token string, value []byte, stored time.Time, err error) {
+	if versioned {
+		sep := strings.LastIndexByte(text, ' ')
+		if sep < 0 {
+			return "", nil, time.Time{}, fmt.Errorf("missing stored time")
+		}
+		unix, err := strconv.ParseInt(text[sep+1:], 10, 64)
+		if err != nil {
+			return "", nil, time.Time{}, err
+		}
+		stored = time.Unix(unix, 0)
+		text = text[:sep]
+	}
+	// The value is base64 so the last space separates it from the token
+	sep := strings.LastIndexByte(text, ' ')
+	if sep < 0 {
+		return "", nil, time.Time{}, fmt.Errorf("missing value")
+	}
+	value, err = base64.StdEncoding.DecodeString(text[sep+1:])
+	return text[:sep], value, stored, err
+}
+
+// Store the value of token and append it to the file, known tokens are not written again and
+// it fails with ErrTokenCollision when token keeps another value
+func (fv *FileVault) Store(ctx context.Context, token string, value []byte) error {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+	if known, ok, _ := fv.MemoryVault.Load(ctx, token); ok {
+		if !bytes.Equal(known, value) {
+			return fmt.Errorf("%w: %s", ErrTokenCollision, token)
+		}
+		return nil
+	}
+	stored := time.Now()
+	if _, err := fmt.Fprintf(fv.file, "%s %s %d\n", token, base64.StdEncoding.EncodeToString(value),
+		stored.Unix()); err != nil {
+		return err
+	}
+	if err := fv.add(token, value, stored, false); err != nil {
+		return err
+	}
+	fv.lines++
+	if fv.lines > 2*fv.Len()+vaultCompactSlack {
+		// The value is stored, the file is compacted again with the next one
+		if err := fv.compact(); err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("path", fv.path).Msg("vault compaction error")
+		}
+	}
+	return nil
+}
+
+// compact rewrites the file with the entries kept and opens it for appending, fv.mu must be held
+// once the vault is open
+func (fv *FileVault) compact() error {
+	tmp := fv.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	w.WriteString(vaultHeader + "\n")
+	lines := 0
+	err = fv.each(func(e *vaultEntry) error {
+		lines++
+		_, err := fmt.Fprintf(w, "%s %s %d\n", e.token, base64.StdEncoding.EncodeToString(e.value), e.stored.Unix())
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, fv.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	appended, err := os.OpenFile(fv.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if fv.file != nil {
+		fv.file.Close()
+	}
+	fv.file, fv.lines = appended, lines
+	return nil
+}
+
+// Close the vault file
+func (fv *FileVault) Close() error {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+	return fv.file.Close()
+}
+
+// VaultTokenizer emits the stable tokens of an HMACTokenizer and keeps their original values in
+// a Vault, so they can be detokenized. The values only masked in logs are not kept.
+type VaultTokenizer struct {
+	*HMACTokenizer
+	Vault Vault
+}
+
+// NewVaultTokenizer creates a tokenizer storing the values of its tokens in vault
+func NewVaultTokenizer(secret string, length int, vault Vault) *VaultTokenizer {
+	return &VaultTokenizer{HMACTokenizer: NewHMACTokenizer(secret, length), Vault: vault}
+}
+
+// Tokenize returns the token of value after storing value in the vault
+func (vt *VaultTokenizer) Tokenize(ctx context.Context, kind string, value []byte) ([]byte, error) {
+	token, err := vt.HMACTokenizer.Tokenize(ctx, kind, value)
+	if err != nil || proxy.MasksLog(ctx) {
+		return token, err
+	}
+	if err := vt.Vault.Store(ctx, string(token), value); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Detokenize returns the original value of token
+func (vt *VaultTokenizer) Detokenize(ctx context.Context, token string) ([]byte, bool, error) {
+	return vt.Vault.Load(ctx, token)
+}
@@ -0,0 +1,153 @@
+package masker_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"reverseproxy/internal/masker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryVault(t *testing.T) {
+	vault := masker.NewMemoryVault(masker.VaultLimits{})
+	require.NoError(t, vault.Store(context.TODO(), "email_3f9a1c", []byte("john")))
+
+	value, ok, err := vault.Load(context.TODO(), "email_3f9a1c")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "john", string(value))
+
+	_, ok, err = vault.Load(context.TODO(), "email_000000")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemoryVault_Limits(t *testing.T) {
+	vault := masker.NewMemoryVault(masker.VaultLimits{MaxEntries: 2, TTL: 50 * time.Millisecond})
+	for _, token := range []string{"a", "b", "c"} {
+		require.NoError(t, vault.Store(context.TODO(), token, []byte(token)))
+	}
+	// The oldest entry is dropped beyond MaxEntries
+	assert.Equal(t, 2, vault.Len())
+	_, ok, _ := vault.Load(context.TODO(), "a")
+	assert.False(t, ok)
+	_, ok, _ = vault.Load(context.TODO(), "c")
+	assert.True(t, ok)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok, _ = vault.Load(context.TODO(), "c")
+	assert.False(t, ok, "expired entries must not be loaded")
+}
+
+func TestMemoryVault_Collision(t *testing.T) {
+	vault := masker.NewMemoryVault(masker.VaultLimits{})
+	require.NoError(t, vault.Store(context.TODO(), "email_3f9a1c", []byte("john")))
+	require.NoError(t, vault.Store(context.TODO(), "email_3f9a1c", []byte("john")))
+
+	err := vault.Store(context.TODO(), "email_3f9a1c", []byte("jane"))
+	assert.ErrorIs(t, err, masker.ErrTokenCollision)
+	value, _, _ := vault.Load(context.TODO(), "email_3f9a1c")
+	assert.Equal(t, "john", string(value), "the first value must be kept")
+}
+
+func TestFileVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	vault, err := masker.OpenFileVault(path, masker.VaultLimits{})
+	require.NoError(t, err)
+	require.NoError(t, vault.Store(context.TODO(), "email_3f9a1c", []byte("john")))
+	require.NoError(t, vault.Store(context.TODO(), "regex label_1b2c3d", []byte("a value\nwith lines")))
+	require.NoError(t, vault.Close())
+
+	reopened, err := masker.OpenFileVault(path, masker.VaultLimits{})
+	require.NoError(t, err)
+	defer reopened.Close()
+	testCases := map[string]struct {
+		token    string
+		expected string
+		found    bool
+	}{
+		"Stored":          {token: "email_3f9a1c", expected: "john", found: true},
+		"TokenWithSpaces": {token: "regex label_1b2c3d", expected: "a value\nwith lines", found: true},
+		"Unknown":         {token: "email_000000"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			value, ok, err := reopened.Load(context.TODO(), tc.token)
+			require.NoError(t, err)
+			assert.Equal(t, tc.found, ok)
+			assert.Equal(t, tc.expected, string(value))
+		})
+	}
+}
+
+func TestFileVault_Collision(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	vault, err := masker.OpenFileVault(path, masker.VaultLimits{})
+	require.NoError(t, err)
+	require.NoError(t, vault.Store(context.TODO(), "email_3f9a1c", []byte("john")))
+	assert.ErrorIs(t, vault.Store(context.TODO(), "email_3f9a1c", []byte("jane")), masker.ErrTokenCollision)
+	require.NoError(t, vault.Close())
+
+	reopened, err := masker.OpenFileVault(path, masker.VaultLimits{})
+	require.NoError(t, err)
+	defer reopened.Close()
+	value, _, _ := reopened.Load(context.TODO(), "email_3f9a1c")
+	assert.Equal(t, "john", string(value), "the colliding value must not be written")
+}
+
+func TestFileVault_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	// Entries without stored time, written before vaults had limits
+	legacy := "email_1 YQ==\nemail_2 Yg==\nemail_3 Yw==\n"
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0o600))
+	vault, err := masker.OpenFileVault(path, masker.VaultLimits{MaxEntries: 2})
+	require.NoError(t, err)
+	require.NoError(t, vault.Store(context.TODO(), "email_4", []byte("d")))
+	require.NoError(t, vault.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "# reverseproxy vault v2", lines[0])
+	assert.Regexp(t, `^email_2 Yg== \d+$`, lines[1])
+	assert.Regexp(t, `^email_3 Yw== \d+$`, lines[2])
+	assert.Regexp(t, `^email_4 ZA== \d+$`, lines[3])
+
+	// The entries stored longer than the TTL ago are dropped when the file is opened
+	expired := "# reverseproxy vault v2\nemail_1 YQ== 1000\nemail_2 Yg== " +
+		strconv.FormatInt(time.Now().Unix(), 10) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(expired), 0o600))
+	reopened, err := masker.OpenFileVault(path, masker.VaultLimits{TTL: time.Hour})
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, 1, reopened.Len())
+	value, ok, err := reopened.Load(context.TODO(), "email_2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "b", string(value))
+}
+
+func TestVaultTokenizer_Detokenize(t *testing.T) {
+	tokenizer := masker.NewVaultTokenizer("a-very-secret-key", 16, masker.NewMemoryVault(masker.VaultLimits{}))
+	m := masker.NewEmailMasker()
+	m.SetTokenizer(tokenizer)
+	masked, err := m.Mask(context.TODO(), []byte("mail john@example.com"))
+	require.NoError(t, err)
+
+	hmacToken, err := masker.NewHMACTokenizer("a-very-secret-key", 16).Tokenize(context.TODO(), "email", []byte("john"))
+	require.NoError(t, err)
+	assert.Equal(t, "mail "+string(hmacToken)+"@example.com", string(masked), "tokens must match HMAC ones")
+
+	value, ok, err := tokenizer.Detokenize(context.TODO(), string(hmacToken))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "john", string(value))
+}
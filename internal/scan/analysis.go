@@ -0,0 +1,395 @@
+package scan
+
+import (
+	"bytes"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// byteSet is a set of byte values
+type byteSet [256]bool
+
+func (s *byteSet) addRange(lo, hi rune) {
+	if lo > hi {
+		return
+	}
+	for r := lo; r <= hi && r < utf8.RuneSelf; r++ {
+		s[r] = true
+	}
+	if hi >= utf8.RuneSelf {
+		// Multi-byte runes, any lead or continuation byte may appear
+		for b := 0x80; b <= 0xff; b++ {
+			s[b] = true
+		}
+	}
+}
+
+// addFirst adds the first byte of the UTF-8 encodings of the runes in [lo, hi]
+func (s *byteSet) addFirst(lo, hi rune) {
+	if lo > hi {
+		return
+	}
+	for r := lo; r <= hi && r < utf8.RuneSelf; r++ {
+		s[r] = true
+	}
+	if hi >= utf8.RuneSelf {
+		for b := 0xc2; b <= 0xf4; b++ {
+			s[b] = true
+		}
+	}
+}
+
+func (s *byteSet) union(o *byteSet) {
+	for i, ok := range o {
+		s[i] = s[i] || ok
+	}
+}
+
+func (s *byteSet) len() int {
+	n := 0
+	for _, ok := range s {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// analysis is what the prefilter knows about a regexp: the bytes that can appear in a match,
+// and a set of bytes one of which appears in every match.
+type analysis struct {
+	allowed byteSet
+	// required is only meaningful when hasRequired, otherwise matches may be empty
+	required    byteSet
+	hasRequired bool
+	// minLen is the length in bytes of the shortest match
+	minLen int
+	// literals are strings one of which appears in every match, lower-cased when foldCase,
+	// empty when they are too short to be worth searching
+	literals []string
+	foldCase bool
+}
+
+// minLiteral is the length of the shortest literal worth searching before running a regexp
+const minLiteral = 3
+
+func analyze(re *regexp.Regexp) analysis {
+	var a analysis
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		// The pattern compiled, this can't happen, but a full scan is always correct
+		for i := range a.allowed {
+			a.allowed[i] = true
+		}
+		return a
+	}
+	parsed = parsed.Simplify()
+	allowed(parsed, &a.allowed)
+	a.required, a.hasRequired = required(parsed)
+	a.minLen = minLen(parsed)
+	if lits, fold, ok := literals(parsed); ok && shortest(lits) >= minLiteral {
+		a.literals, a.foldCase = lits, fold
+	}
+	return a
+}
+
+func allowed(re *syntax.Regexp, s *byteSet) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			for _, f := range fold(r, re.Flags) {
+				s.addRange(f, f)
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			s.addRange(re.Rune[i], re.Rune[i+1])
+		}
+	case syntax.OpAnyChar:
+		s.addRange(0, unicode.MaxRune)
+	case syntax.OpAnyCharNotNL:
+		s.addRange(0, '\n'-1)
+		s.addRange('\n'+1, unicode.MaxRune)
+	default:
+		for _, sub := range re.Sub {
+			allowed(sub, s)
+		}
+	}
+}
+
+// required returns a set of bytes one of which appears in every match of re,
+// false when re can match without consuming bytes.
+func required(re *syntax.Regexp) (byteSet, bool) {
+	var s byteSet
+	switch re.Op {
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return s, false
+		}
+		for _, f := range fold(re.Rune[0], re.Flags) {
+			s.addFirst(f, f)
+		}
+		return s, true
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			s.addFirst(re.Rune[i], re.Rune[i+1])
+		}
+		return s, true
+	case syntax.OpAnyChar:
+		s.addFirst(0, unicode.MaxRune)
+		return s, true
+	case syntax.OpAnyCharNotNL:
+		s.addFirst(0, '\n'-1)
+		s.addFirst('\n'+1, unicode.MaxRune)
+		return s, true
+	case syntax.OpNoMatch:
+		return s, true
+	case syntax.OpCapture, syntax.OpPlus:
+		return required(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return s, false
+		}
+		return required(re.Sub[0])
+	case syntax.OpConcat:
+		// The most selective requirement of the parts
+		found := false
+		for _, sub := range re.Sub {
+			if r, ok := required(sub); ok && (!found || r.len() < s.len()) {
+				s, found = r, true
+			}
+		}
+		return s, found
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			r, ok := required(sub)
+			if !ok {
+				return s, false
+			}
+			s.union(&r)
+		}
+		return s, true
+	}
+	return s, false
+}
+
+// minLen returns the length in bytes of the shortest match of re
+func minLen(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		n := 0
+		for _, r := range re.Rune {
+			shortest := utf8.UTFMax
+			for _, f := range fold(r, re.Flags) {
+				if l := utf8.RuneLen(f); l > 0 && l < shortest {
+					shortest = l
+				}
+			}
+			n += shortest
+		}
+		return n
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return 0
+		}
+		return utf8.RuneLen(re.Rune[0])
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return minLen(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * minLen(re.Sub[0])
+	case syntax.OpConcat:
+		n := 0
+		for _, sub := range re.Sub {
+			n += minLen(sub)
+		}
+		return n
+	case syntax.OpAlternate:
+		n := -1
+		for _, sub := range re.Sub {
+			if l := minLen(sub); n < 0 || l < n {
+				n = l
+			}
+		}
+		if n < 0 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+// maxExact is the largest set of strings expanded from a pattern
+const maxExact = 32
+
+// literals returns strings one of which appears in every match of re, and whether they are
+// matched case-insensitively, in which case they are lower-cased.
+func literals(re *syntax.Regexp) ([]string, bool, bool) {
+	if lits, fold, ok := exact(re); ok && shortest(lits) > 0 {
+		return lits, fold, true
+	}
+	switch re.Op {
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil, false, false
+		}
+		return literals(re.Sub[0])
+	case syntax.OpConcat:
+		// The longest literals of the parts
+		var best []string
+		var bestFold, found bool
+		for _, sub := range re.Sub {
+			if lits, fold, ok := literals(sub); ok && (!found || shortest(lits) > shortest(best)) {
+				best, bestFold, found = lits, fold, true
+			}
+		}
+		return best, bestFold, found
+	case syntax.OpAlternate:
+		var all []string
+		var fold bool
+		for _, sub := range re.Sub {
+			lits, f, ok := literals(sub)
+			if !ok {
+				return nil, false, false
+			}
+			all, fold = append(all, lits...), fold || f
+		}
+		return lowerIf(all, fold), fold, true
+	}
+	return nil, false, false
+}
+
+// exact returns every string re matches when they are a few, and whether they are matched
+// case-insensitively, in which case they are lower-cased.
+func exact(re *syntax.Regexp) ([]string, bool, bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}, false, true
+	case syntax.OpLiteral:
+		fold := re.Flags&syntax.FoldCase != 0
+		for _, r := range re.Rune {
+			// Only ASCII folds can be compared byte by byte
+			if fold && r >= utf8.RuneSelf {
+				return nil, false, false
+			}
+		}
+		return lowerIf([]string{string(re.Rune)}, fold), fold, true
+	case syntax.OpCharClass:
+		var lits []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if len(lits) == maxExact {
+					return nil, false, false
+				}
+				lits = append(lits, string(r))
+			}
+		}
+		return lits, false, true
+	case syntax.OpCapture:
+		return exact(re.Sub[0])
+	case syntax.OpQuest:
+		lits, fold, ok := exact(re.Sub[0])
+		return append(lits, ""), fold, ok
+	case syntax.OpConcat:
+		lits, fold := []string{""}, false
+		for _, sub := range re.Sub {
+			next, f, ok := exact(sub)
+			if !ok || len(lits)*len(next) > maxExact {
+				return nil, false, false
+			}
+			var product []string
+			for _, l := range lits {
+				for _, n := range next {
+					product = append(product, l+n)
+				}
+			}
+			lits, fold = product, fold || f
+		}
+		return lowerIf(lits, fold), fold, true
+	case syntax.OpAlternate:
+		var all []string
+		var fold bool
+		for _, sub := range re.Sub {
+			lits, f, ok := exact(sub)
+			if !ok || len(all)+len(lits) > maxExact {
+				return nil, false, false
+			}
+			all, fold = append(all, lits...), fold || f
+		}
+		return lowerIf(all, fold), fold, true
+	}
+	return nil, false, false
+}
+
+func lowerIf(lits []string, fold bool) []string {
+	if fold {
+		for i, l := range lits {
+			lits[i] = strings.ToLower(l)
+		}
+	}
+	return lits
+}
+
+func shortest(lits []string) int {
+	n := -1
+	for _, l := range lits {
+		if n < 0 || len(l) < n {
+			n = len(l)
+		}
+	}
+	return n
+}
+
+// containsLiteral reports whether text contains one of the literals of a
+func (a *analysis) containsLiteral(text []byte) bool {
+	if len(a.literals) == 0 {
+		return true
+	}
+	for _, lit := range a.literals {
+		if !a.foldCase {
+			if bytes.Contains(text, []byte(lit)) {
+				return true
+			}
+			continue
+		}
+		if indexFold(text, lit) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// indexFold returns the index of the lower-cased ASCII lit in text ignoring case, -1 if not found
+func indexFold(text []byte, lit string) int {
+	first, upper := lit[0], lit[0]
+	if 'a' <= first && first <= 'z' {
+		upper = first - 'a' + 'A'
+	}
+	for i := 0; i+len(lit) <= len(text); i++ {
+		if c := text[i]; c != first && c != upper {
+			continue
+		}
+		if bytes.EqualFold(text[i:i+len(lit)], []byte(lit)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// fold returns r and, when matched case-insensitively, every rune it folds to
+func fold(r rune, flags syntax.Flags) []rune {
+	runes := []rune{r}
+	if flags&syntax.FoldCase == 0 {
+		return runes
+	}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		runes = append(runes, f)
+	}
+	return runes
+}
@@ -0,0 +1,288 @@
+// Package scan finds the patterns of several maskers in a single pass over a body.
+//
+// A pattern can only match runs of the bytes that appear in it, so the body is split in segments
+// of those bytes. The regexp only runs on the segments long enough for a match that contain a byte
+// every match requires, e.g. an '@' for emails, and the literals of the pattern if any. The bytes
+// of every pattern are classified together with one table lookup per body byte.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"math/bits"
+	"regexp"
+	"sync"
+)
+
+// maxPrefiltered is the number of rules the prefilter tracks, the rest scan the whole body
+const maxPrefiltered = 64
+
+// Rule is a pattern a masker replaces.
+type Rule struct {
+	Regexp *regexp.Regexp
+	// Group is the submatch replaced, the whole match when 0
+	Group int
+	// Valid filters the matches, it receives the whole body and the bounds of the replaced group
+	Valid func(text []byte, start, end int) bool
+	// Replace returns the replacement of a match, m are the submatch indexes in text
+	Replace func(ctx context.Context, text []byte, m []int) ([]byte, error)
+	// Fit returns the end of the match at text[start:end], which may be shortened, and true, or
+	// false and where to search for the next match. Rules with Fit replace the whole match, ignore
+	// Group and must not use assertions as they are matched on the rest of the segment.
+	Fit func(text []byte, start, end int) (int, bool)
+
+	once          sync.Once
+	analysis      analysis
+	prefilterable bool
+}
+
+func (r *Rule) analyze() {
+	r.once.Do(func() {
+		r.analysis = analyze(r.Regexp)
+		// Without a required byte matches may be empty, with every byte allowed the segment would
+		// be the whole body, and the regexp package already skips to the literal prefixes
+		prefix, _ := r.Regexp.LiteralPrefix()
+		r.prefilterable = r.analysis.hasRequired && r.analysis.allowed.len() < 256 && len(prefix) < minLiteral
+	})
+}
+
+// Match is a match of a rule, Sub are its submatch indexes in the body
+type Match struct {
+	Start, End int
+	Rule       *Rule
+	Sub        []int
+}
+
+// Engine finds and replaces the matches of its rules in a single pass.
+// When matches of different rules overlap the rule given first wins.
+type Engine struct {
+	rules []*Rule
+	// prefiltered rules by bit, and the rules scanning the whole body, with their index in rules
+	prefiltered []*Rule
+	full        []*Rule
+	prefPos     []int
+	fullPos     []int
+	// allowed and required have a bit set for every prefiltered rule that allows or requires the byte
+	allowed  [256]uint64
+	required [256]uint64
+	// scratch holds the *scratch slices reused by Find
+	scratch sync.Pool
+}
+
+// scratch are the matches of every rule and the merged ones while Find runs
+type scratch struct {
+	found         [][]Match
+	merged, spare []Match
+}
+
+// New creates an engine for rules, in priority order
+func New(rules ...*Rule) *Engine {
+	e := &Engine{rules: rules}
+	for pos, r := range rules {
+		r.analyze()
+		if !r.prefilterable || len(e.prefiltered) == maxPrefiltered {
+			e.full = append(e.full, r)
+			e.fullPos = append(e.fullPos, pos)
+			continue
+		}
+		bit := uint64(1) << len(e.prefiltered)
+		e.prefiltered = append(e.prefiltered, r)
+		e.prefPos = append(e.prefPos, pos)
+		for b := 0; b < 256; b++ {
+			if r.analysis.allowed[b] {
+				e.allowed[b] |= bit
+			}
+			if r.analysis.required[b] {
+				e.required[b] |= bit
+			}
+		}
+	}
+	return e
+}
+
+// Find returns the matches of every rule in text, ordered and without overlaps.
+// It is safe for concurrent use.
+func (e *Engine) Find(text []byte) []Match {
+	sc, _ := e.scratch.Get().(*scratch)
+	if sc == nil {
+		sc = &scratch{found: make([][]Match, len(e.rules))}
+	}
+	found := sc.found
+	e.segments(text, func(i, start, end int) {
+		// One byte of context on each side keeps assertions like \b right, it can't be part of a match
+		if start > 0 {
+			start--
+		}
+		if end < len(text) {
+			end++
+		}
+		pos := e.prefPos[i]
+		found[pos] = e.find(found[pos], e.prefiltered[i], text, start, end)
+	})
+	for i, r := range e.full {
+		pos := e.fullPos[i]
+		found[pos] = e.find(found[pos], r, text, 0, len(text))
+	}
+	merged := sc.merged[:0]
+	spare := sc.spare
+	for pos := range found {
+		if len(found[pos]) > 0 {
+			merged, spare = merge(spare[:0], merged, found[pos]), merged
+		}
+	}
+	var matches []Match
+	if len(merged) > 0 {
+		matches = append(make([]Match, 0, len(merged)), merged...)
+	}
+	// The scratch slices keep their capacity, not the matches of text
+	for pos := range found {
+		found[pos] = clearMatches(found[pos])
+	}
+	sc.merged, sc.spare = clearMatches(merged), clearMatches(spare)
+	e.scratch.Put(sc)
+	return matches
+}
+
+// clearMatches empties matches, dropping the references of its elements
+func clearMatches(matches []Match) []Match {
+	for i := range matches {
+		matches[i] = Match{}
+	}
+	return matches[:0]
+}
+
+// Replace returns text with every match replaced
+func (e *Engine) Replace(ctx context.Context, text []byte) ([]byte, error) {
+	return ReplaceMatches(ctx, text, e.Find(text))
+}
+
+// ReplaceMatches returns text with matches, as returned by Find, replaced
+func ReplaceMatches(ctx context.Context, text []byte, matches []Match) ([]byte, error) {
+	if len(matches) == 0 {
+		return text, nil
+	}
+	var replaced bytes.Buffer
+	replaced.Grow(len(text))
+	last := 0
+	for _, m := range matches {
+		replacement, err := m.Rule.Replace(ctx, text, m.Sub)
+		if err != nil {
+			return nil, err
+		}
+		replaced.Write(text[last:m.Start])
+		replaced.Write(replacement)
+		last = m.End
+	}
+	replaced.Write(text[last:])
+	return replaced.Bytes(), nil
+}
+
+// segments calls fn with the index of a prefiltered rule and every run of bytes allowed by the rule
+// containing one of its required bytes
+func (e *Engine) segments(text []byte, fn func(i, start, end int)) {
+	if len(e.prefiltered) == 0 {
+		return
+	}
+	var starts [maxPrefiltered]int
+	var prev, seen uint64
+	flush := func(ended uint64, end int) {
+		for candidates := ended & seen; candidates != 0; candidates &= candidates - 1 {
+			i := bits.TrailingZeros64(candidates)
+			if r := e.prefiltered[i]; end-starts[i] >= r.analysis.minLen {
+				fn(i, starts[i], end)
+			}
+		}
+		seen &^= ended
+	}
+	for i, c := range text {
+		cur := e.allowed[c]
+		if cur != prev {
+			if ended := prev &^ cur; ended != 0 {
+				flush(ended, i)
+			}
+			for started := cur &^ prev; started != 0; started &= started - 1 {
+				starts[bits.TrailingZeros64(started)] = i
+			}
+			prev = cur
+		}
+		seen |= e.required[c] & cur
+	}
+	flush(prev, len(text))
+}
+
+// find appends the valid matches of r in text[start:end] to matches
+func (e *Engine) find(matches []Match, r *Rule, text []byte, start, end int) []Match {
+	segment := text[start:end]
+	if !r.analysis.containsLiteral(segment) {
+		return matches
+	}
+	if r.Fit != nil {
+		return e.fit(matches, r, text, start, end)
+	}
+	// Most segments hold a single match, finding the first one allocates less than finding them all
+	first := r.Regexp.FindSubmatchIndex(segment)
+	if first == nil {
+		return matches
+	}
+	if first[1] > first[0] && len(segment)-first[1] < r.analysis.minLen {
+		return e.appendMatch(matches, r, text, start, first)
+	}
+	for _, sub := range r.Regexp.FindAllSubmatchIndex(segment, -1) {
+		matches = e.appendMatch(matches, r, text, start, sub)
+	}
+	return matches
+}
+
+// fit appends the matches of r in text[start:end] as shortened by r.Fit
+func (e *Engine) fit(matches []Match, r *Rule, text []byte, start, end int) []Match {
+	for pos := start; pos < end; {
+		loc := r.Regexp.FindIndex(text[pos:end])
+		if loc == nil {
+			break
+		}
+		s, en := pos+loc[0], pos+loc[1]
+		fit, ok := r.Fit(text, s, en)
+		if ok && fit > s && (r.Valid == nil || r.Valid(text, s, fit)) {
+			matches = append(matches, Match{Start: s, End: fit, Rule: r, Sub: []int{s, fit}})
+		}
+		if pos = fit; pos <= s {
+			pos = s + 1
+		}
+	}
+	return matches
+}
+
+// appendMatch appends the match of r with the submatch indexes sub in text[start:], when valid
+func (e *Engine) appendMatch(matches []Match, r *Rule, text []byte, start int, sub []int) []Match {
+	for i := range sub {
+		if sub[i] >= 0 {
+			sub[i] += start
+		}
+	}
+	s, en := sub[2*r.Group], sub[2*r.Group+1]
+	if s < 0 || (r.Valid != nil && !r.Valid(text, s, en)) {
+		return matches
+	}
+	return append(matches, Match{Start: s, End: en, Rule: r, Sub: sub})
+}
+
+// merge appends to merged the accepted matches and the ordered matches of a rule, dropping the ones
+// overlapping the accepted ones
+func merge(merged, accepted, matches []Match) []Match {
+	i := 0
+	for _, m := range matches {
+		for i < len(accepted) && accepted[i].End <= m.Start {
+			merged = append(merged, accepted[i])
+			i++
+		}
+		if i < len(accepted) && accepted[i].Start < m.End {
+			continue
+		}
+		// A previous match of the same rule may overlap when submatches are replaced
+		if n := len(merged); n > 0 && merged[n-1].End > m.Start {
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return append(merged, accepted[i:]...)
+}
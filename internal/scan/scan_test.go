@@ -0,0 +1,126 @@
+package scan_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"reverseproxy/internal/scan"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replaceWith returns a rule replacing the matches of pattern with replacement
+func replaceWith(pattern, replacement string) *scan.Rule {
+	return &scan.Rule{
+		Regexp: regexp.MustCompile(pattern),
+		Replace: func(ctx context.Context, text []byte, m []int) ([]byte, error) {
+			return []byte(replacement), nil
+		},
+	}
+}
+
+func TestEngine_Replace(t *testing.T) {
+	digits := replaceWith(`\d{4}`, "[digits]")
+	digits.Valid = func(text []byte, start, end int) bool { return text[start] != '0' }
+	group := replaceWith(`key=(\w+)`, "[key]")
+	group.Group = 1
+	testCases := map[string]struct {
+		rules    []*scan.Rule
+		input    string
+		expected string
+	}{
+		"NoMatches": {
+			rules:    []*scan.Rule{replaceWith(`@\w+`, "[at]")},
+			input:    "nothing to see",
+			expected: "nothing to see",
+		},
+		"SeveralRules": {
+			rules:    []*scan.Rule{replaceWith(`@\w+`, "[at]"), digits},
+			input:    "ping @john at 1234, not 0123",
+			expected: "ping [at] at [digits], not 0123",
+		},
+		"Group": {
+			rules:    []*scan.Rule{group},
+			input:    "url?key=abc&key=def",
+			expected: "url?key=[key]&key=[key]",
+		},
+		"FirstRuleWinsOverlaps": {
+			rules:    []*scan.Rule{replaceWith(`b+c`, "[bc]"), replaceWith(`a+b`, "[ab]"), replaceWith(`c+d`, "[cd]")},
+			input:    "aabbccdd ab cd",
+			expected: "aa[bc]cdd [ab] [cd]",
+		},
+		"WordBoundaries": {
+			rules:    []*scan.Rule{replaceWith(`\b\d{3}\b`, "[num]")},
+			input:    "x123 123 123x 1234 (123)",
+			expected: "x123 [num] 123x 1234 ([num])",
+		},
+		"CaseInsensitive": {
+			rules:    []*scan.Rule{replaceWith(`(?i)secret`, "[s]")},
+			input:    "SECRET Secret sEcReT",
+			expected: "[s] [s] [s]",
+		},
+		"EveryByteAllowed": {
+			rules:    []*scan.Rule{replaceWith(`BEGIN[\s\S]*?END`, "[block]")},
+			input:    "a BEGIN\nkey\nEND b",
+			expected: "a [block] b",
+		},
+		"Unicode": {
+			rules:    []*scan.Rule{replaceWith(`ñ+`, "[ñ]")},
+			input:    "año ññ",
+			expected: "a[ñ]o [ñ]",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			replaced, err := scan.New(tc.rules...).Replace(context.TODO(), []byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(replaced))
+		})
+	}
+}
+
+func TestEngine_ReplaceError(t *testing.T) {
+	rule := &scan.Rule{
+		Regexp: regexp.MustCompile(`\d+`),
+		Replace: func(ctx context.Context, text []byte, m []int) ([]byte, error) {
+			return nil, errors.New("tokenizer down")
+		},
+	}
+	_, err := scan.New(rule).Replace(context.TODO(), []byte("call 1234"))
+	assert.EqualError(t, err, "tokenizer down")
+}
+
+func TestEngine_Find(t *testing.T) {
+	// The engine must find what the regexp finds in the whole text
+	patterns := []string{`\d{3}-\d{4}`, `(?i)[a-z]+@[a-z]+\.com`, `\bfoo\b`, `x*y`, `x?`, `(?m)^#\w+`,
+		`(?i)(?:password|pwd|api[_-]?key)\s*=\s*(\w+)`, `BEGIN[^!]+END`}
+	text := bytes.Repeat([]byte("foo 555-1234 John@Mail.com foobar, xxxy y xyxy\n#tag (foo) 12-3456 #no\n"+
+		"PWD=1, Api-Key = abc, apikey=, pass=word BEGIN a END!\n"), 50)
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			re := regexp.MustCompile(pattern)
+			var found [][]int
+			for _, m := range scan.New(&scan.Rule{Regexp: re}).Find(text) {
+				found = append(found, m.Sub)
+			}
+			assert.Equal(t, re.FindAllSubmatchIndex(text, -1), found)
+		})
+	}
+}
+
+func TestEngine_FindReused(t *testing.T) {
+	// Find reuses its buffers, the matches it returned before must not change
+	e := scan.New(replaceWith(`\d+`, "#"), replaceWith(`[a-z]+@[a-z]+\.com`, "@"))
+	first := e.Find([]byte("john@mail.com 1234"))
+	second := e.Find([]byte("12 ann@mail.com 3"))
+	assert.Equal(t, []scan.Match{{Start: 0, End: 13, Rule: first[0].Rule, Sub: []int{0, 13}},
+		{Start: 14, End: 18, Rule: first[1].Rule, Sub: []int{14, 18}}}, first)
+	require.Len(t, second, 3)
+	assert.Equal(t, []int{0, 2}, second[0].Sub)
+	assert.Equal(t, []int{3, 15}, second[1].Sub)
+	assert.Equal(t, []int{16, 17}, second[2].Sub)
+}
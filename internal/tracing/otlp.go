@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// scopeName identifies the spans of the proxy
+const scopeName = "reverseproxy"
+
+// OTLPExporter exports spans to an OTLP/HTTP collector with the JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates an exporter posting to the traces endpoint of a collector, e.g.
+// http://localhost:4318/v1/traces, with headers such as the credentials of the backend.
+func NewOTLPExporter(endpoint, service string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		service:  service,
+		headers:  headers,
+		client:   &http.Client{Timeout: exportTimeout},
+	}
+}
+
+// Export posts spans in a single request
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp: collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below are the JSON mapping of the OTLP ExportTraceServiceRequest
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			TraceState:        s.SpanContext.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        keyValues(s.Attributes),
+			Status:            otlpStatus{Code: s.StatusCode, Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		converted = append(converted, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: keyValues([]Attribute{{Key: "service.name", Value: e.service}})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: converted}},
+	}}}
+}
+
+func keyValues(attrs []Attribute) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: a.Key, Value: anyValue(a.Value)})
+	}
+	return kvs
+}
+
+func anyValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case []string:
+		values := make([]otlpAnyValue, 0, len(v))
+		for _, s := range v {
+			values = append(values, anyValue(s))
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
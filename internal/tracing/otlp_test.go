@@ -0,0 +1,77 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reverseproxy/internal/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPExporter_Export(t *testing.T) {
+	var received map[string]interface{}
+	var header http.Header
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer collector.Close()
+	exporter := tracing.NewOTLPExporter(collector.URL+"/v1/traces", "reverseproxy",
+		map[string]string{"Authorization": "Bearer key"})
+	start := time.Unix(1700000000, 5)
+	err := exporter.Export(context.Background(), []tracing.SpanData{{
+		Name: "proxy request",
+		Kind: tracing.KindServer,
+		SpanContext: tracing.SpanContext{
+			TraceID:    tracing.TraceID{0x4b, 0xf9, 15: 0x36},
+			SpanID:     tracing.SpanID{0x00, 0xf0, 7: 0xb7},
+			Sampled:    true,
+			TraceState: "rojo=1",
+		},
+		Parent: tracing.SpanID{7: 1},
+		Start:  start,
+		End:    start.Add(time.Second),
+		Attributes: []tracing.Attribute{
+			{Key: "http.method", Value: "GET"},
+			{Key: "http.status_code", Value: 502},
+			{Key: "masker.changed", Value: []string{"email"}},
+			{Key: "monitored", Value: true},
+		},
+		StatusCode:    tracing.StatusError,
+		StatusMessage: "502 Bad Gateway",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer key", header.Get("Authorization"))
+	expected := `{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"reverseproxy"}}]},
+		"scopeSpans":[{"scope":{"name":"reverseproxy"},"spans":[{
+			"traceId":"4bf90000000000000000000000000036","spanId":"00f00000000000b7","traceState":"rojo=1",
+			"parentSpanId":"0000000000000001","name":"proxy request","kind":2,
+			"startTimeUnixNano":"1700000000000000005","endTimeUnixNano":"1700000001000000005",
+			"attributes":[
+				{"key":"http.method","value":{"stringValue":"GET"}},
+				{"key":"http.status_code","value":{"intValue":"502"}},
+				{"key":"masker.changed","value":{"arrayValue":{"values":[{"stringValue":"email"}]}}},
+				{"key":"monitored","value":{"boolValue":true}}],
+			"status":{"code":2,"message":"502 Bad Gateway"}}]}]}]}`
+	actual, err := json.Marshal(received)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(actual))
+}
+
+func TestOTLPExporter_ExportError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	exporter := tracing.NewOTLPExporter(collector.URL, "reverseproxy", nil)
+	err := exporter.Export(context.Background(), []tracing.SpanData{{Name: "span"}})
+	assert.EqualError(t, err, "otlp: collector responded 503 Service Unavailable")
+}
@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// queueSize is the number of spans waiting for export, spans are dropped when it is full
+	queueSize = 2048
+	// maxBatchSize is the number of spans exported at once
+	maxBatchSize = 512
+	// batchTimeout is how long spans wait for a batch to fill
+	batchTimeout = 5 * time.Second
+	// exportTimeout is how long an export can take
+	exportTimeout = 10 * time.Second
+)
+
+// Exporter sends ended spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Tracer starts spans and exports them in batches in the background
+type Tracer struct {
+	exporter Exporter
+	log      zerolog.Logger
+	spans    chan SpanData
+	flush    chan chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// NewTracer creates a tracer exporting with exporter, export errors are logged with log
+func NewTracer(exporter Exporter, log zerolog.Logger) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		log:      log,
+		spans:    make(chan SpanData, queueSize),
+		flush:    make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// ForceFlush exports the queued spans
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case t.flush <- done:
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued spans and stops the tracer, spans ended afterwards are dropped
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.stop) })
+	select {
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(s SpanData) {
+	select {
+	case <-t.stop:
+	case t.spans <- s:
+	default:
+		t.log.Warn().Str("span_name", s.Name).Msg("span queue full, span dropped")
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(batchTimeout)
+	defer ticker.Stop()
+	var batch []SpanData
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			t.log.Error().Err(err).Int("spans", len(batch)).Msg("span export error")
+		}
+		batch = nil
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-t.spans:
+				batch = append(batch, s)
+				if len(batch) >= maxBatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-t.flush:
+			drain()
+			close(done)
+		case <-t.stop:
+			drain()
+			return
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package tracing records the spans of the requests going through the proxy and propagates their
+// context with the W3C traceparent and tracestate headers.
+//
+// Spans are exported in batches by a Tracer, spans of requests whose caller did not sample them
+// are propagated but not exported.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C trace context headers
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// IsValid reports whether t is not all zeros
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// SpanID identifies a span in a trace
+type SpanID [8]byte
+
+// IsValid reports whether s is not all zeros
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// SpanContext is what is propagated of a span
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid reports whether sc has a trace and a span ID
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Extract returns the span context of the traceparent and tracestate headers of h
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, ok := parseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers of h to sc
+func Inject(h http.Header, sc SpanContext) {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set(TraceparentHeader, "00-"+sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+flags)
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// parseTraceparent parses a version-format-trace_id-parent_id-trace_flags header
+func parseTraceparent(v string) (SpanContext, bool) {
+	v = strings.TrimSpace(v)
+	// Later versions can append fields, version 00 can't
+	if len(v) < 55 || (len(v) > 55 && (v[:2] == "00" || v[55] != '-')) {
+		return SpanContext{}, false
+	}
+	if v[2] != '-' || v[35] != '-' || v[52] != '-' || v[:2] == "ff" {
+		return SpanContext{}, false
+	}
+	var version, flags [1]byte
+	var sc SpanContext
+	if !decodeLowerHex(version[:], v[:2]) || !decodeLowerHex(sc.TraceID[:], v[3:35]) ||
+		!decodeLowerHex(sc.SpanID[:], v[36:52]) || !decodeLowerHex(flags[:], v[53:55]) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Kind is the role of a span, with the OTLP values
+type Kind int
+
+// Span kinds
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// StatusCode is the status of a span, with the OTLP values
+type StatusCode int
+
+// Status codes
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key and a string, int64, bool or []string value
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData is an ended span
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	SpanContext   SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Span is an operation of a trace. Its methods do nothing on a nil span, which is what is started
+// when there is no tracer.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext returns the context propagated to the children of s
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttribute sets the value of key, replacing the previous one
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+// SetError sets the status of s to error with the message of err
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.StatusCode = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// End ends s and queues it for export if it is sampled, only the first call has an effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	if s.data.SpanContext.Sampled {
+		s.tracer.enqueue(s.data)
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s, the parent of the spans started from it
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span carried by ctx, nil if none
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying the span context of a caller, the
+// parent of the spans started from it when ctx carries no span
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start starts a child of the span carried by ctx with its tracer. Without a span it returns ctx
+// and a nil span.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+// Start starts a span, the child of the span or the remote span context carried by ctx, a new
+// trace otherwise. Spans without parent are sampled.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := &Span{tracer: t, data: SpanData{Name: name, Kind: kind, Start: time.Now()}}
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.SpanContext()
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = remote
+	}
+	if parent.IsValid() {
+		s.data.SpanContext = parent
+		s.data.Parent = parent.SpanID
+	} else {
+		rand.Read(s.data.SpanContext.TraceID[:])
+		s.data.SpanContext.Sampled = true
+	}
+	rand.Read(s.data.SpanContext.SpanID[:])
+	return ContextWithSpan(ctx, s), s
+}
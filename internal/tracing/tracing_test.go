@@ -0,0 +1,152 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"reverseproxy/internal/tracing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	tests := map[string]struct {
+		traceparent string
+		tracestate  []string
+		expected    string
+		sampled     bool
+		ok          bool
+	}{
+		"Sampled": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			tracestate:  []string{"rojo=00f067aa0ba902b7", "congo=t61rcWkgMzE"},
+			expected:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled:     true,
+			ok:          true,
+		},
+		"NotSampled": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			expected:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			ok:          true,
+		},
+		"FutureVersion": {
+			traceparent: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-will-be-like",
+			expected:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled:     true,
+			ok:          true,
+		},
+		"Missing": {},
+		"InvalidVersion": {
+			traceparent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		"Version00TooLong": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		},
+		"UpperCase": {
+			traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		},
+		"ZeroTraceID": {
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		},
+		"ZeroSpanID": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		},
+		"NotHex": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.traceparent != "" {
+				h.Set(tracing.TraceparentHeader, tt.traceparent)
+			}
+			for _, ts := range tt.tracestate {
+				h.Add(tracing.TracestateHeader, ts)
+			}
+			sc, ok := tracing.Extract(h)
+			require.Equal(t, tt.ok, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tt.sampled, sc.Sampled)
+			injected := http.Header{}
+			tracing.Inject(injected, sc)
+			assert.Equal(t, tt.expected, injected.Get(tracing.TraceparentHeader))
+			if len(tt.tracestate) > 0 {
+				assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", injected.Get(tracing.TracestateHeader))
+			}
+		})
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := tracing.NewTracer(exporter, zerolog.Nop())
+	remote, ok := tracing.Extract(traceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	require.True(t, ok)
+
+	ctx, server := tracer.Start(tracing.ContextWithRemoteSpanContext(context.Background(), remote),
+		"server", tracing.KindServer)
+	_, child := tracing.Start(ctx, "child", tracing.KindInternal)
+	child.SetAttribute("names", []string{"a"})
+	child.SetAttribute("names", []string{"b"})
+	child.End()
+	child.End()
+	server.End()
+	_, root := tracer.Start(context.Background(), "root", tracing.KindServer)
+	root.End()
+	unsampled, ok := tracing.Extract(traceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"))
+	require.True(t, ok)
+	_, dropped := tracer.Start(tracing.ContextWithRemoteSpanContext(context.Background(), unsampled),
+		"unsampled", tracing.KindServer)
+	dropped.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := exporter.spans
+	require.Len(t, spans, 3)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, remote.TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, server.SpanContext().SpanID, spans[0].Parent)
+	assert.Equal(t, []tracing.Attribute{{Key: "names", Value: []string{"b"}}}, spans[0].Attributes)
+	assert.Equal(t, "server", spans[1].Name)
+	assert.Equal(t, remote.TraceID, spans[1].SpanContext.TraceID)
+	assert.Equal(t, remote.SpanID, spans[1].Parent)
+	assert.Equal(t, "root", spans[2].Name)
+	assert.NotEqual(t, remote.TraceID, spans[2].SpanContext.TraceID)
+	assert.False(t, spans[2].Parent.IsValid())
+	assert.True(t, spans[2].SpanContext.Sampled)
+}
+
+func TestStart_WithoutSpan(t *testing.T) {
+	ctx := context.Background()
+	started, span := tracing.Start(ctx, "child", tracing.KindInternal)
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, started)
+	// A nil span does nothing
+	span.SetAttribute("key", "value")
+	span.End()
+	assert.False(t, span.SpanContext().IsValid())
+}
+
+func traceparent(v string) http.Header {
+	h := http.Header{}
+	h.Set(tracing.TraceparentHeader, v)
+	return h
+}
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *memoryExporter) Export(ctx context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
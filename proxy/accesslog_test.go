@@ -0,0 +1,276 @@
+package proxy_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"reverseproxy/internal/accesslog"
+	masks "reverseproxy/internal/masker"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_AccessLog(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8088,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatCombined, nil, zerolog.InfoLevel, &out)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8088/teapot?brew=1", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "test-agent")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+	assert.Regexp(t, `^127\.0\.0\.1 - - \[.+\] "GET /teapot\?brew=1 HTTP/1\.1" 418 11 "-" "test-agent"\n$`, out.String())
+}
+
+func TestReverseProxy_AccessLogRedaction(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user":"alice"}`))
+	}))
+	defer targetServer.Close()
+	masker := &MockMasker{
+		fn: func(b []byte) ([]byte, error) {
+			return bytes.ReplaceAll(b, []byte("alice"), []byte("*****")), nil
+		},
+	}
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8089,
+		[]proxy.Masker{masker},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatJSON,
+		[]string{accesslog.FieldPath, accesslog.FieldRequestHeaders, accesslog.FieldRequestBody,
+			accesslog.FieldResponseBody},
+		zerolog.InfoLevel, &out)
+	reverseProxy.AccessLog.Redaction.Bodies = true
+	// The name is cut by the limit, it is masked before
+	reverseProxy.AccessLog.Redaction.MaxBodyBytes = 12
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	// POST responses are not masked, their logged values are
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:8089/users/alice",
+		strings.NewReader(`{"user":"alice"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, `{"user":"alice"}`, string(body))
+	assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+	assert.JSONEq(t, `{"level":"info","path":"/users/*****","request_headers":{`+
+		`"Authorization":"[REDACTED]","Content-Length":"16","Content-Type":"application/json",`+
+		`"User-Agent":"Go-http-client/1.1","X-Request-Id":"req-1"},"request_body":"{\"user\":\"***",`+
+		`"response_body":"{\"user\":\"***","message":"request received"}`, out.String())
+}
+
+func TestReverseProxy_AccessLogVault(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mail ann@example.com"))
+	}))
+	defer targetServer.Close()
+	vault := masks.NewMemoryVault(masks.VaultLimits{})
+	masker := masks.NewEmailMasker()
+	masker.SetTokenizer(masks.NewVaultTokenizer("a-very-secret-key", 16, vault))
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8099,
+		[]proxy.Masker{masker},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatJSON, []string{accesslog.FieldRequestBody},
+		zerolog.InfoLevel, &out)
+	reverseProxy.AccessLog.Redaction.Bodies = true
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+
+	// POST responses are not masked, the value only masked in the log is not kept
+	resp, err := http.Post("http://localhost:8099/", "text/plain", strings.NewReader("mail john@example.com"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+	assert.Regexp(t, `"request_body":"mail email_[0-9a-f]{16}@example.com"`, out.String())
+	assert.Equal(t, 0, vault.Len())
+
+	resp, err = http.Get("http://localhost:8099/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Regexp(t, `^mail email_[0-9a-f]{16}@example.com$`, string(body))
+	assert.Equal(t, 1, vault.Len())
+}
+
+func TestReverseProxy_AccessLogCapture(t *testing.T) {
+	var handler http.HandlerFunc
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8090,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatJSON,
+		[]string{accesslog.FieldStatus, accesslog.FieldBytes, accesslog.FieldResponseBody},
+		zerolog.InfoLevel, &out)
+	reverseProxy.AccessLog.Redaction.Bodies = true
+	reverseProxy.AccessLog.Redaction.MaxBodyBytes = 8
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	tests := map[string]struct {
+		handler  http.HandlerFunc
+		blocked  bool
+		expected string
+	}{
+		"Chunks": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				for _, chunk := range []string{"Hello", " ", "World"} {
+					w.Write([]byte(chunk))
+					w.(http.Flusher).Flush()
+				}
+			},
+			expected: `{"level":"info","status":200,"bytes":11,"response_body":"Hello Wo","message":"request received"}`,
+		},
+		"NoContent": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expected: `{"level":"info","status":204,"bytes":0,"response_body":"","message":"request received"}`,
+		},
+		"ImplicitStatus": {
+			handler:  func(w http.ResponseWriter, r *http.Request) {},
+			expected: `{"level":"info","status":200,"bytes":0,"response_body":"","message":"request received"}`,
+		},
+		"Blocked": {
+			blocked: true,
+			expected: `{"level":"warn","status":403,"bytes":8,"response_body":"blocked\n",` +
+				`"message":"request received"}`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler = tt.handler
+			blocker := &MockBlocker{fn: func() (bool, error) { return tt.blocked, nil }}
+			require.NoError(t, reverseProxy.Reload(targetServer.URL, []proxy.Masker{}, []proxy.Blocker{blocker}))
+			out.Reset()
+			resp, err := http.Get("http://localhost:8090/capture")
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+			assert.JSONEq(t, tt.expected, out.String())
+		})
+	}
+}
+
+func TestReverseProxy_AccessLogUpgrade(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		conn.Write([]byte(line))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8091,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatCommon, nil, zerolog.InfoLevel, &out)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	conn, err := net.Dial("tcp", "localhost:8091")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /echo HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	_, err = conn.Write([]byte("ping\n"))
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+	conn.Close()
+	assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+	// The size is what was sent on the upgraded connection
+	assert.Regexp(t, `"GET /echo HTTP/1\.1" 101 5\n$`, out.String())
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, entries are logged asynchronously
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// maxDetokenizeTokens limits the tokens resolved by a single request
+const maxDetokenizeTokens = 1000
+
+// Detokenizer resolves tokens emitted by maskers back to their original values.
+type Detokenizer interface {
+	Detokenize(ctx context.Context, token string) ([]byte, bool, error)
+}
+
+type detokenization struct {
+	path        string
+	detokenizer Detokenizer
+	apiKeys     [][]byte
+}
+
+// WithDetokenization serves POST requests to path, with a JSON body {"tokens": ["email_3f9a1c"]},
+// answering {"values": {"email_3f9a1c": "john"}} for the tokens d knows. Clients must authenticate
+// with one of apiKeys as a bearer token, the requests never reach the target server.
+func WithDetokenization(path string, d Detokenizer, apiKeys []string) Option {
+	return func(st *state) {
+		dt := &detokenization{path: path, detokenizer: d}
+		for _, k := range apiKeys {
+			dt.apiKeys = append(dt.apiKeys, []byte(k))
+		}
+		st.detokenization = dt
+	}
+}
+
+func (dt *detokenization) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !dt.authorized(r) {
+		log.Warn().Str("remote_addr", r.RemoteAddr).Msg("unauthorized detokenization request")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Tokens []string `json:"tokens"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Tokens) > maxDetokenizeTokens {
+		http.Error(w, "too many tokens", http.StatusRequestEntityTooLarge)
+		return
+	}
+	values := map[string]string{}
+	for _, token := range req.Tokens {
+		value, ok, err := dt.detokenizer.Detokenize(r.Context(), token)
+		if err != nil {
+			log.Error().Err(err).Msg("detokenization error")
+			http.Error(w, "detokenization error", http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			values[token] = string(value)
+		}
+	}
+	log.Info().Str("remote_addr", r.RemoteAddr).Int("tokens", len(req.Tokens)).Int("resolved", len(values)).
+		Msg("tokens detokenized")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+}
+
+func (dt *detokenization) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	key := []byte(strings.TrimPrefix(auth, "Bearer "))
+	for _, k := range dt.apiKeys {
+		if subtle.ConstantTimeCompare(key, k) == 1 {
+			return true
+		}
+	}
+	return false
+}
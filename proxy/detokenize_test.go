@@ -0,0 +1,104 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_Detokenization(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8085,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop(),
+		proxy.WithDetokenization("/detokenize", MockDetokenizer{"email_3f9a1c": "john"},
+			[]string{"a-very-secret-api-key"}))
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	tests := map[string]struct {
+		method       string
+		path         string
+		apiKey       string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		"Detokenize": {
+			method:       http.MethodPost,
+			path:         "/detokenize",
+			apiKey:       "a-very-secret-api-key",
+			body:         `{"tokens": ["email_3f9a1c", "email_000000"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"values":{"email_3f9a1c":"john"}}` + "\n",
+		},
+		"InvalidAPIKey": {
+			method:       http.MethodPost,
+			path:         "/detokenize",
+			apiKey:       "another-api-key",
+			body:         `{"tokens": ["email_3f9a1c"]}`,
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: "unauthorized\n",
+		},
+		"InvalidBody": {
+			method:       http.MethodPost,
+			path:         "/detokenize",
+			apiKey:       "a-very-secret-api-key",
+			body:         `["email_3f9a1c"]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid request body\n",
+		},
+		"InvalidMethod": {
+			method:       http.MethodGet,
+			path:         "/detokenize",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "method not allowed\n",
+		},
+		"OtherPathsAreProxied": {
+			method:       http.MethodGet,
+			path:         "/",
+			expectedCode: http.StatusOK,
+			expectedBody: "Hello World",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "http://localhost:8085"+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.apiKey != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.apiKey)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body := new(bytes.Buffer)
+			_, err = body.ReadFrom(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode, "invalid status code")
+			assert.Equal(t, tt.expectedBody, body.String(), "invalid response body")
+		})
+	}
+}
+
+type MockDetokenizer map[string]string
+
+func (d MockDetokenizer) Detokenize(ctx context.Context, token string) ([]byte, bool, error) {
+	value, ok := d[token]
+	return []byte(value), ok, nil
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Forwarding headers
+const (
+	HeaderXForwardedFor   = "X-Forwarded-For"
+	HeaderXForwardedHost  = "X-Forwarded-Host"
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+	HeaderForwarded       = "Forwarded"
+	HeaderVia             = "Via"
+)
+
+// forwardingHeaders are the headers stripped from the requests of untrusted peers
+var forwardingHeaders = []string{HeaderXForwardedFor, HeaderXForwardedHost, HeaderXForwardedProto, HeaderForwarded}
+
+// DefaultVia is the name of the proxy in the Via header when none is set
+const DefaultVia = "reverseproxy"
+
+// Forwarding controls the headers telling the target about the client and the original request.
+type Forwarding struct {
+	// Headers are the forwarding headers set on the upstream request, among the Header constants
+	Headers []string
+	// Via is the name of the proxy in the Via header, DefaultVia when empty
+	Via string
+	// PreserveHost keeps the Host header of the client instead of the target host
+	PreserveHost bool
+	// TrustedProxies are the peers whose forwarding headers are appended to, they are stripped
+	// from the requests of any other peer
+	TrustedProxies []*net.IPNet
+}
+
+// DefaultForwarding sets the X-Forwarded headers and trusts no peer
+var DefaultForwarding = Forwarding{
+	Headers: []string{HeaderXForwardedFor, HeaderXForwardedHost, HeaderXForwardedProto},
+}
+
+// WithForwarding sets the forwarding headers of the upstream requests, DefaultForwarding by default
+func WithForwarding(f Forwarding) Option {
+	return func(st *state) {
+		st.forwarding = f
+	}
+}
+
+// director returns the director of the upstream requests, it runs the director of the single
+// host proxy, sets the Host and the forwarding headers and applies the header rules. WebSocket
+// extensions are not negotiated when their messages are masked.
+func (st *state) director(director func(*http.Request)) func(*http.Request) {
+	return func(req *http.Request) {
+		director(req)
+		f := &st.forwarding
+		host := req.Host
+		if !f.PreserveHost {
+			req.Host = st.target.Host
+		}
+		if !f.trusts(req.RemoteAddr) {
+			for _, h := range forwardingHeaders {
+				req.Header.Del(h)
+			}
+		}
+		proto := "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+		// The client address is appended to X-Forwarded-For by the reverse proxy, a nil value omits it
+		if !f.sets(HeaderXForwardedFor) {
+			req.Header[HeaderXForwardedFor] = nil
+		}
+		if f.sets(HeaderXForwardedHost) && req.Header.Get(HeaderXForwardedHost) == "" {
+			req.Header.Set(HeaderXForwardedHost, host)
+		}
+		if f.sets(HeaderXForwardedProto) && req.Header.Get(HeaderXForwardedProto) == "" {
+			req.Header.Set(HeaderXForwardedProto, proto)
+		}
+		if f.sets(HeaderForwarded) {
+			appendHeader(req.Header, HeaderForwarded, forwardedElement(req.RemoteAddr, host, proto))
+		}
+		if f.sets(HeaderVia) {
+			appendHeader(req.Header, HeaderVia, f.via(req.ProtoMajor, req.ProtoMinor))
+		}
+		applyRequestHeaderRules(req.Context(), req.Header)
+		if st.webSocketMasking && isWebSocket(req.Header) {
+			req.Header.Del(headerWebSocketExtensions)
+		}
+	}
+}
+
+// sets reports whether f sets header
+func (f *Forwarding) sets(header string) bool {
+	for _, h := range f.Headers {
+		if http.CanonicalHeaderKey(h) == header {
+			return true
+		}
+	}
+	return false
+}
+
+// trusts reports whether the peer at remoteAddr is a trusted proxy
+func (f *Forwarding) trusts(remoteAddr string) bool {
+	if len(f.TrustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, n := range f.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// via returns the Via entry of a message received with the protocol version major.minor
+func (f *Forwarding) via(major, minor int) string {
+	name := f.Via
+	if name == "" {
+		name = DefaultVia
+	}
+	return fmt.Sprintf("%d.%d %s", major, minor, name)
+}
+
+// forwardedElement returns the RFC 7239 element of a request
+func forwardedElement(remoteAddr, host, proto string) string {
+	var params []string
+	if ip, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		if strings.Contains(ip, ":") {
+			// IPv6 addresses are bracketed and quoted
+			ip = `"[` + ip + `]"`
+		}
+		params = append(params, "for="+ip)
+	}
+	if host != "" {
+		params = append(params, "host="+quoteForwarded(host))
+	}
+	params = append(params, "proto="+proto)
+	return strings.Join(params, ";")
+}
+
+// quoteForwarded quotes v unless it is a token
+func quoteForwarded(v string) string {
+	for _, c := range v {
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' ||
+			strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+	}
+	return v
+}
+
+// appendHeader appends v to the comma separated list of header h
+func appendHeader(h http.Header, name, v string) {
+	if prior := h.Values(name); len(prior) > 0 {
+		v = strings.Join(prior, ", ") + ", " + v
+	}
+	h.Set(name, v)
+}
@@ -0,0 +1,99 @@
+package proxy_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_Forwarding(t *testing.T) {
+	var upstream *http.Request
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	target, err := url.Parse(targetServer.URL)
+	require.NoError(t, err)
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8094,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	_, loopback, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	tests := map[string]struct {
+		forwarding *proxy.Forwarding
+		incoming   http.Header
+		host       string
+		expected   http.Header
+		via        string
+	}{
+		"Default": {
+			incoming: http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Forwarded-Proto": {"https"},
+				"Forwarded": {"for=1.2.3.4"}},
+			host: target.Host,
+			expected: http.Header{"X-Forwarded-For": {"127.0.0.1"}, "X-Forwarded-Host": {"localhost:8094"},
+				"X-Forwarded-Proto": {"http"}},
+		},
+		"TrustedProxy": {
+			forwarding: &proxy.Forwarding{
+				Headers:        proxy.DefaultForwarding.Headers,
+				TrustedProxies: []*net.IPNet{loopback},
+			},
+			incoming: http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Forwarded-Host": {"example.com"},
+				"X-Forwarded-Proto": {"https"}},
+			host: target.Host,
+			expected: http.Header{"X-Forwarded-For": {"1.2.3.4, 127.0.0.1"}, "X-Forwarded-Host": {"example.com"},
+				"X-Forwarded-Proto": {"https"}},
+		},
+		"ForwardedAndVia": {
+			forwarding: &proxy.Forwarding{
+				Headers:        []string{proxy.HeaderForwarded, proxy.HeaderVia},
+				Via:            "edge",
+				PreserveHost:   true,
+				TrustedProxies: []*net.IPNet{loopback},
+			},
+			incoming: http.Header{"Forwarded": {"for=1.2.3.4"}, "Via": {"1.1 cdn"}},
+			host:     "localhost:8094",
+			expected: http.Header{"Forwarded": {`for=1.2.3.4, for=127.0.0.1;host="localhost:8094";proto=http`},
+				"Via": {"1.1 cdn, 1.1 edge"}},
+			via: "1.1 edge",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []proxy.Option
+			if tt.forwarding != nil {
+				opts = append(opts, proxy.WithForwarding(*tt.forwarding))
+			}
+			require.NoError(t, reverseProxy.Reload(targetServer.URL, []proxy.Masker{}, []proxy.Blocker{}, opts...))
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:8094/hello", nil)
+			require.NoError(t, err)
+			for k, v := range tt.incoming {
+				req.Header[k] = v
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.host, upstream.Host)
+			for _, h := range []string{"X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "Forwarded", "Via"} {
+				assert.Equal(t, tt.expected.Values(h), upstream.Header.Values(h), h)
+			}
+			assert.Equal(t, tt.via, resp.Header.Get("Via"))
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HeaderTemplateVars are the placeholders replaced in the header values of the rules
+var HeaderTemplateVars = []string{"{client_ip}", "{request_id}", "{route}", "{host}", "{method}", "{path}"}
+
+// HeaderRule changes the headers of the requests of a route before they are forwarded and of
+// their responses before they are returned.
+type HeaderRule struct {
+	// Name of the route, the {route} placeholder
+	Name string
+	// PathPrefixes match the request path, every request matches when empty
+	PathPrefixes []string
+	Request      HeaderOps
+	Response     HeaderOps
+}
+
+// HeaderOps are applied in order: renames, removals, sets and additions. The values set and
+// added can contain the HeaderTemplateVars.
+type HeaderOps struct {
+	// Rename maps the current names of headers to their new ones, applied in the order of the
+	// current names
+	Rename map[string]string
+	Remove []string
+	// Set replaces the values of headers
+	Set map[string]string
+	// Add appends values to headers
+	Add map[string]string
+}
+
+type headerRulesKey struct{}
+
+// WithHeaderRules applies every rule whose route matches the request, in order
+func WithHeaderRules(rules ...HeaderRule) Option {
+	return func(st *state) {
+		st.headerRules = rules
+	}
+}
+
+// Matches reports whether r is in the route of hr
+func (hr *HeaderRule) Matches(r *http.Request) bool {
+	if len(hr.PathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range hr.PathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHeaderRules returns the rules matching r with the values of their templates
+func (st *state) matchHeaderRules(r *http.Request) []matchedHeaderRule {
+	var matched []matchedHeaderRule
+	for i := range st.headerRules {
+		hr := &st.headerRules[i]
+		if !hr.Matches(r) {
+			continue
+		}
+		clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientIP = r.RemoteAddr
+		}
+		vars := strings.NewReplacer("{client_ip}", clientIP, "{request_id}", requestID(r.Context()),
+			"{route}", hr.Name, "{host}", r.Host, "{method}", r.Method, "{path}", r.URL.Path)
+		matched = append(matched, matchedHeaderRule{rule: hr, vars: vars})
+	}
+	return matched
+}
+
+// withHeaderRules returns r with the rules matched in its context
+func withHeaderRules(r *http.Request, matched []matchedHeaderRule) *http.Request {
+	if len(matched) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), headerRulesKey{}, matched))
+}
+
+// matchedHeaderRule is a rule matching a request and the values of its templates
+type matchedHeaderRule struct {
+	rule *HeaderRule
+	vars *strings.Replacer
+}
+
+// applyRequestHeaderRules applies the request ops of the rules selected for the request of ctx to h
+func applyRequestHeaderRules(ctx context.Context, h http.Header) {
+	matched, _ := ctx.Value(headerRulesKey{}).([]matchedHeaderRule)
+	removesXFF := false
+	for _, m := range matched {
+		m.rule.Request.apply(h, m.vars)
+		removesXFF = removesXFF || m.rule.Request.removes(HeaderXForwardedFor)
+	}
+	// The reverse proxy adds the client address to X-Forwarded-For unless its value is nil
+	if _, ok := h[HeaderXForwardedFor]; !ok && removesXFF {
+		h[HeaderXForwardedFor] = nil
+	}
+}
+
+// applyResponseHeaderRules applies the response ops of the rules selected for the request of ctx to h
+func applyResponseHeaderRules(ctx context.Context, h http.Header) {
+	matched, _ := ctx.Value(headerRulesKey{}).([]matchedHeaderRule)
+	for _, m := range matched {
+		m.rule.Response.apply(h, m.vars)
+	}
+}
+
+// headerRulesWriter applies the response ops of the rules to the final response written, so they
+// also apply to the responses of the proxy: blocked requests, redirects and errors. Protocol
+// switches are written on the hijacked connection, modifyResponse applies the rules to them.
+type headerRulesWriter struct {
+	http.ResponseWriter
+	rules   []matchedHeaderRule
+	applied bool
+}
+
+func (w *headerRulesWriter) apply(code int) {
+	// Informational statuses precede the final one
+	if w.applied || code < 200 {
+		return
+	}
+	w.applied = true
+	for _, m := range w.rules {
+		m.rule.Response.apply(w.Header(), m.vars)
+	}
+}
+
+func (w *headerRulesWriter) WriteHeader(code int) {
+	w.apply(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerRulesWriter) Write(b []byte) (int, error) {
+	w.apply(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerRulesWriter) Flush() {
+	w.apply(http.StatusOK)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *headerRulesWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer
+func (w *headerRulesWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (ops *HeaderOps) apply(h http.Header, vars *strings.Replacer) {
+	for _, from := range sortedKeys(ops.Rename) {
+		if values := h.Values(from); len(values) > 0 {
+			h.Del(from)
+			h[http.CanonicalHeaderKey(ops.Rename[from])] = values
+		}
+	}
+	for _, name := range ops.Remove {
+		h.Del(name)
+	}
+	for _, name := range sortedKeys(ops.Set) {
+		h.Set(name, vars.Replace(ops.Set[name]))
+	}
+	for _, name := range sortedKeys(ops.Add) {
+		h.Add(name, vars.Replace(ops.Add[name]))
+	}
+}
+
+// removes reports whether ops removes or renames header
+func (ops *HeaderOps) removes(header string) bool {
+	for from := range ops.Rename {
+		if http.CanonicalHeaderKey(from) == header {
+			return true
+		}
+	}
+	for _, name := range ops.Remove {
+		if http.CanonicalHeaderKey(name) == header {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"reverseproxy/internal/blocker"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_HeaderRules(t *testing.T) {
+	var upstream http.Header
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("X-Powered-By", "PHP/5.6")
+		w.Header().Set("X-Internal", "node-3")
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	rules := []proxy.HeaderRule{
+		{
+			Name:         "api",
+			PathPrefixes: []string{"/api"},
+			Request: proxy.HeaderOps{
+				Rename: map[string]string{"X-Token": "Authorization"},
+				Remove: []string{"X-Debug", "X-Forwarded-For"},
+				Set:    map[string]string{"X-Client-IP": "{client_ip}", "X-Route": "{route}"},
+				Add:    map[string]string{"X-Request-Origin": "{request_id}"},
+			},
+			Response: proxy.HeaderOps{
+				Rename: map[string]string{"X-Internal": "X-Upstream"},
+				Remove: []string{"Server", "X-Powered-By"},
+				Set:    map[string]string{"Strict-Transport-Security": "max-age=63072000"},
+			},
+		},
+		{
+			Name:     "all",
+			Response: proxy.HeaderOps{Add: map[string]string{"X-Served-By": "{route} {method} {path}"}},
+		},
+	}
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8095,
+		[]proxy.Masker{},
+		[]proxy.Blocker{&blocker.PathBlocker{Path: []string{"/api/admin"}}},
+		zerolog.Nop(),
+		proxy.WithHeaderRules(rules...),
+		proxy.WithRewriteRules(proxy.RewriteRule{
+			Pattern:        regexp.MustCompile(`^/api/old/(.*)$`),
+			Replacement:    "/api/new/$1",
+			RedirectStatus: http.StatusMovedPermanently,
+		}))
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	tests := map[string]struct {
+		path             string
+		expectedStatus   int
+		expectedUpstream http.Header
+		expectedResponse http.Header
+	}{
+		"APIRoute": {
+			path:           "/api/users",
+			expectedStatus: http.StatusOK,
+			expectedUpstream: http.Header{
+				"Authorization":    {"secret"},
+				"X-Debug":          nil,
+				"X-Token":          nil,
+				"X-Forwarded-For":  nil,
+				"X-Client-Ip":      {"127.0.0.1"},
+				"X-Route":          {"api"},
+				"X-Request-Origin": {"req-1"},
+			},
+			expectedResponse: http.Header{
+				"Server":                    nil,
+				"X-Powered-By":              nil,
+				"X-Internal":                nil,
+				"X-Upstream":                {"node-3"},
+				"Strict-Transport-Security": {"max-age=63072000"},
+				"X-Served-By":               {"all GET /api/users"},
+			},
+		},
+		"OtherRoute": {
+			path:           "/other",
+			expectedStatus: http.StatusOK,
+			expectedUpstream: http.Header{
+				"X-Debug":         {"1"},
+				"X-Token":         {"secret"},
+				"X-Forwarded-For": {"127.0.0.1"},
+				"X-Route":         nil,
+			},
+			expectedResponse: http.Header{
+				"Server":      {"nginx"},
+				"X-Internal":  {"node-3"},
+				"X-Served-By": {"all GET /other"},
+			},
+		},
+		"Blocked": {
+			path:           "/api/admin",
+			expectedStatus: http.StatusForbidden,
+			expectedResponse: http.Header{
+				"Strict-Transport-Security": {"max-age=63072000"},
+				"X-Served-By":               {"all GET /api/admin"},
+			},
+		},
+		"Redirected": {
+			path:           "/api/old/users",
+			expectedStatus: http.StatusMovedPermanently,
+			expectedResponse: http.Header{
+				"Location":                  {"/api/new/users"},
+				"Strict-Transport-Security": {"max-age=63072000"},
+				"X-Served-By":               {"all GET /api/old/users"},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:8095"+tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("X-Token", "secret")
+			req.Header.Set("X-Debug", "1")
+			req.Header.Set("X-Request-ID", "req-1")
+			upstream = nil
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			for name, values := range tt.expectedUpstream {
+				assert.Equal(t, values, upstream.Values(name), name)
+			}
+			for name, values := range tt.expectedResponse {
+				assert.Equal(t, values, resp.Header.Values(name), name)
+			}
+		})
+	}
+}
+
+func TestReverseProxy_HeaderRulesTargetDown(t *testing.T) {
+	reverseProxy, err := proxy.New("http://localhost:1",
+		8100,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop(),
+		proxy.WithHeaderRules(proxy.HeaderRule{
+			Response: proxy.HeaderOps{Set: map[string]string{"Strict-Transport-Security": "max-age=63072000"}},
+		}))
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	resp, err := http.Get("http://localhost:8100")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "max-age=63072000", resp.Header.Get("Strict-Transport-Security"))
+}
@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"reverseproxy/internal/accesslog"
+)
+
+func (rp *ReverseProxy) withLoggingHandlerFunc(al *accesslog.Logger, handler http.HandlerFunc) http.HandlerFunc {
+	loggingFn := func(rw http.ResponseWriter, req *http.Request) {
+		// Bodies are only captured when they are logged, a bit beyond the size logged
+		maxBody := al.Redaction.CaptureBytes()
+		lrw := &loggingResponseWriter{ResponseWriter: rw, body: limitedBuffer{max: maxBody}}
+		reqBody := &limitedBuffer{max: maxBody}
+		received := &countingReader{}
+		if req.Body != nil && req.Body != http.NoBody {
+			received.Reader = req.Body
+			if maxBody > 0 {
+				received.Reader = io.TeeReader(req.Body, reqBody)
+			}
+			req.Body = readCloser{received, req.Body}
+		}
+		start := time.Now()
+		// The entry is also logged when the handler aborts, e.g. when the client leaves a stream
+		defer func() {
+			duration := time.Since(start)
+			sent, receivedBytes := lrw.bytes, received.n.Load()
+			if lrw.conn != nil {
+				sent += lrw.conn.written.Load()
+				receivedBytes += lrw.conn.read.Load()
+			}
+			entry := &accesslog.Entry{
+				Time:            start,
+				Duration:        duration,
+				Status:          lrw.status(),
+				Bytes:           sent,
+				BytesReceived:   receivedBytes,
+				Method:          req.Method,
+				Path:            req.URL.Path,
+				Query:           req.URL.RawQuery,
+				Proto:           req.Proto,
+				Host:            req.Host,
+				RemoteAddr:      req.RemoteAddr,
+				UserAgent:       req.UserAgent(),
+				Referer:         req.Referer(),
+				RequestID:       requestID(req.Context()),
+				RequestHeaders:  req.Header.Clone(),
+				ResponseHeaders: lrw.Header().Clone(),
+				RequestBody:     reqBody.Bytes(),
+				ResponseBody:    lrw.body.Bytes(),
+			}
+			// The entry is masked before the handler returns, with the maskers serving the request,
+			// only writing it is left to another goroutine
+			if al.Redact(req.Context(), entry) {
+				go al.Write(entry)
+			}
+		}()
+		handler.ServeHTTP(lrw, req)
+	}
+	return http.HandlerFunc(loggingFn)
+}
+
+// readCloser reads from a Reader and closes a Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// countingReader counts the bytes read from a Reader, the request body is read by the transport
+type countingReader struct {
+	io.Reader
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// countingConn counts the bytes read from and written to a hijacked connection, both ways are
+// copied concurrently
+type countingConn struct {
+	net.Conn
+	read, written atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// CloseWrite half-closes the connection when it supports it, the end of the upstream stream is
+// propagated to the client
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return http.ErrNotSupported
+}
+
+// limitedBuffer keeps the first max bytes written to it, the rest is discarded
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// loggingResponseWriter records the status, the size and a bounded copy of the response.
+// Flushing, hijacking and pushing are passed through to the underlying writer, the hijacked
+// connection counts what is sent and received on it.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+	body       limitedBuffer
+	hijacked   bool
+	conn       *countingConn
+}
+
+// status is the status sent to the client, 200 when the handler never set one. Connections are
+// only hijacked to switch protocols, their status is written on the hijacked connection.
+func (lrw *loggingResponseWriter) status() int {
+	switch {
+	case lrw.statusCode != 0:
+		return lrw.statusCode
+	case lrw.hijacked:
+		return http.StatusSwitchingProtocols
+	default:
+		return http.StatusOK
+	}
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	// Informational statuses precede the final one, only the first final status is sent
+	if lrw.statusCode == 0 && code >= 200 {
+		lrw.statusCode = code
+	}
+	lrw.ResponseWriter.WriteHeader(code)
+}
+
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	if lrw.statusCode == 0 {
+		lrw.statusCode = http.StatusOK
+	}
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytes += int64(n)
+	lrw.body.Write(b[:n])
+	return n, err
+}
+
+func (lrw *loggingResponseWriter) Flush() {
+	f, ok := lrw.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if lrw.statusCode == 0 {
+		lrw.statusCode = http.StatusOK
+	}
+	f.Flush()
+}
+
+func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lrw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	lrw.hijacked = true
+	lrw.conn = &countingConn{Conn: conn}
+	return lrw.conn, brw, nil
+}
+
+func (lrw *loggingResponseWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := lrw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// Unwrap returns the underlying writer
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
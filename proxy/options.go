@@ -0,0 +1,5 @@
+package proxy
+
+// Option configures optional features of the proxy, they are given to New and Reload
+// and apply to the requests served with that configuration.
+type Option func(st *state)
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Policy selects the maskers applied to the responses of the requests it matches.
+// Every criterion set must match, a criterion matches when any of its values does.
+type Policy struct {
+	Name string
+	// Headers maps header names to the value they must have, an empty value matches any value
+	Headers map[string]string
+	// ClientNames match the common name or a DNS name of the verified client certificate
+	ClientNames []string
+	// SourceCIDRs match the address of the client connection
+	SourceCIDRs []*net.IPNet
+	// PathPrefixes match the request path
+	PathPrefixes []string
+	// Maskers applied to the responses, none when empty
+	Maskers []Masker
+}
+
+// WithPolicies selects the maskers of each request with the first matching policy,
+// requests matching none get every masker.
+func WithPolicies(policies ...Policy) Option {
+	return func(st *state) {
+		st.policies = policies
+	}
+}
+
+// Matches reports whether r matches every criterion of the policy
+func (p *Policy) Matches(r *http.Request) bool {
+	for name, value := range p.Headers {
+		got, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok || (value != "" && !contains(got, value)) {
+			return false
+		}
+	}
+	if len(p.ClientNames) > 0 && !p.matchesClientName(r) {
+		return false
+	}
+	if len(p.SourceCIDRs) > 0 && !p.matchesSource(r) {
+		return false
+	}
+	if len(p.PathPrefixes) > 0 && !p.matchesPath(r) {
+		return false
+	}
+	return true
+}
+
+func (p *Policy) matchesClientName(r *http.Request) bool {
+	// Only certificates verified against the client CAs identify a client
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, n := range p.ClientNames {
+		if contains(names, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matchesSource(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range p.SourceCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matchesPath(r *http.Request) bool {
+	for _, prefix := range p.PathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type maskersKey struct{}
+
+// selectMaskers returns r with the maskers of the first policy it matches in its context
+func (st *state) selectMaskers(r *http.Request) *http.Request {
+	for i := range st.policies {
+		p := &st.policies[i]
+		if !p.Matches(r) {
+			continue
+		}
+		log := zerolog.Ctx(r.Context()).With().Str("policy", p.Name).Logger()
+		ctx := context.WithValue(log.WithContext(r.Context()), maskersKey{}, p.Maskers)
+		return r.WithContext(ctx)
+	}
+	return r
+}
+
+// maskersFor returns the maskers selected for the request of ctx, every masker when no policy matched
+func (st *state) maskersFor(ctx context.Context) []Masker {
+	if m, ok := ctx.Value(maskersKey{}).([]Masker); ok {
+		return m
+	}
+	return st.maskers
+}
@@ -0,0 +1,142 @@
+package proxy_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Matches(t *testing.T) {
+	_, internal, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	policy := proxy.Policy{
+		Name:         "admin",
+		Headers:      map[string]string{"X-Role": "admin", "X-Internal": ""},
+		ClientNames:  []string{"admin.internal"},
+		SourceCIDRs:  []*net.IPNet{internal},
+		PathPrefixes: []string{"/admin", "/users"},
+	}
+	adminCert := &x509.Certificate{Subject: pkix.Name{CommonName: "tools"}, DNSNames: []string{"admin.internal"}}
+	tests := map[string]struct {
+		path     string
+		remote   string
+		headers  map[string]string
+		cert     *x509.Certificate
+		expected bool
+	}{
+		"Matching": {
+			path:     "/users/1",
+			remote:   "10.1.2.3:4567",
+			headers:  map[string]string{"X-Role": "admin", "X-Internal": "yes"},
+			cert:     adminCert,
+			expected: true,
+		},
+		"WrongHeaderValue": {
+			path:    "/users/1",
+			remote:  "10.1.2.3:4567",
+			headers: map[string]string{"X-Role": "user", "X-Internal": "yes"},
+			cert:    adminCert,
+		},
+		"MissingHeader": {
+			path:    "/users/1",
+			remote:  "10.1.2.3:4567",
+			headers: map[string]string{"X-Role": "admin"},
+			cert:    adminCert,
+		},
+		"NoClientCert": {
+			path:    "/users/1",
+			remote:  "10.1.2.3:4567",
+			headers: map[string]string{"X-Role": "admin", "X-Internal": "yes"},
+		},
+		"OtherClientCert": {
+			path:    "/users/1",
+			remote:  "10.1.2.3:4567",
+			headers: map[string]string{"X-Role": "admin", "X-Internal": "yes"},
+			cert:    &x509.Certificate{Subject: pkix.Name{CommonName: "public"}},
+		},
+		"OutsideCIDR": {
+			path:    "/users/1",
+			remote:  "192.168.1.1:4567",
+			headers: map[string]string{"X-Role": "admin", "X-Internal": "yes"},
+			cert:    adminCert,
+		},
+		"OtherPath": {
+			path:    "/orders",
+			remote:  "10.1.2.3:4567",
+			headers: map[string]string{"X-Role": "admin", "X-Internal": "yes"},
+			cert:    adminCert,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			assert.Equal(t, tt.expected, policy.Matches(r))
+		})
+	}
+}
+
+func TestReverseProxy_Policies(t *testing.T) {
+	masker := &MockMasker{
+		fn: func(text []byte) ([]byte, error) {
+			return []byte("Masked"), nil
+		},
+	}
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8086,
+		[]proxy.Masker{masker},
+		[]proxy.Blocker{},
+		zerolog.Nop(),
+		proxy.WithPolicies(
+			proxy.Policy{Name: "admin", Headers: map[string]string{"X-Role": "admin"}},
+			proxy.Policy{Name: "support", Headers: map[string]string{"X-Role": "support"},
+				Maskers: []proxy.Masker{masker}},
+		))
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	tests := map[string]struct {
+		role     string
+		expected string
+	}{
+		"policy without maskers": {role: "admin", expected: "Hello World"},
+		"policy with maskers":    {role: "support", expected: "Masked"},
+		"no matching policy":     {role: "public", expected: "Masked"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:8086/", nil)
+			require.NoError(t, err)
+			req.Header.Set("X-Role", tt.role)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(resp.Body)
+			assert.Equal(t, tt.expected, buf.String(), "invalid response body")
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BlockerFactory creates a Blocker from the options of a config entry.
+type BlockerFactory func(options map[string]interface{}) (Blocker, error)
+
+// MaskerFactory creates a Masker from the options of a config entry.
+type MaskerFactory func(options map[string]interface{}) (Masker, error)
+
+var (
+	registryMu sync.RWMutex
+	blockers   = map[string]BlockerFactory{}
+	maskers    = map[string]MaskerFactory{}
+)
+
+// RegisterBlocker makes a blocker factory available under typeName.
+// It is meant to be called from init, it panics if typeName is already registered.
+func RegisterBlocker(typeName string, factory BlockerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := blockers[typeName]; ok {
+		panic(fmt.Sprintf("proxy: blocker type %q registered twice", typeName))
+	}
+	blockers[typeName] = factory
+}
+
+// RegisterMasker makes a masker factory available under typeName.
+// It is meant to be called from init, it panics if typeName is already registered.
+func RegisterMasker(typeName string, factory MaskerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := maskers[typeName]; ok {
+		panic(fmt.Sprintf("proxy: masker type %q registered twice", typeName))
+	}
+	maskers[typeName] = factory
+}
+
+// NewBlocker creates a blocker of the registered typeName.
+func NewBlocker(typeName string, options map[string]interface{}) (Blocker, error) {
+	registryMu.RLock()
+	factory, ok := blockers[typeName]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown blocker type %q", typeName)
+	}
+	return factory(options)
+}
+
+// NewMasker creates a masker of the registered typeName.
+func NewMasker(typeName string, options map[string]interface{}) (Masker, error) {
+	registryMu.RLock()
+	factory, ok := maskers[typeName]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown masker type %q", typeName)
+	}
+	return factory(options)
+}
+
+// BlockerTypes returns the registered blocker types sorted by name.
+func BlockerTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(blockers)
+}
+
+// MaskerTypes returns the registered masker types sorted by name.
+func MaskerTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(maskers)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DecodeOptions decodes options into the struct pointed to by v, for factories.
+// Keys match the struct fields case-insensitively and unknown keys are an error.
+func DecodeOptions(options map[string]interface{}, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"reverseproxy/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type optionsBlocker struct {
+	Paths []string
+	Limit int
+}
+
+func (b *optionsBlocker) Block(ctx context.Context, r *http.Request) (bool, error) {
+	return false, nil
+}
+
+func (b *optionsBlocker) Name() string {
+	return "Options Blocker"
+}
+
+func init() {
+	proxy.RegisterBlocker("test_options", func(options map[string]interface{}) (proxy.Blocker, error) {
+		b := &optionsBlocker{}
+		return b, proxy.DecodeOptions(options, b)
+	})
+	proxy.RegisterMasker("test_masker", func(options map[string]interface{}) (proxy.Masker, error) {
+		return &MockMasker{}, nil
+	})
+}
+
+func TestRegistry_NewBlocker(t *testing.T) {
+	b, err := proxy.NewBlocker("test_options", map[string]interface{}{
+		"paths": []interface{}{"/a", "/b"},
+		"Limit": int64(3),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &optionsBlocker{Paths: []string{"/a", "/b"}, Limit: 3}, b)
+	assert.Contains(t, proxy.BlockerTypes(), "test_options")
+
+	_, err = proxy.NewBlocker("test_options", map[string]interface{}{"unknown": 1})
+	assert.ErrorContains(t, err, "invalid options")
+	_, err = proxy.NewBlocker("missing", nil)
+	assert.EqualError(t, err, `unknown blocker type "missing"`)
+}
+
+func TestRegistry_NewMasker(t *testing.T) {
+	m, err := proxy.NewMasker("test_masker", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Test Masker", m.Name())
+	assert.Contains(t, proxy.MaskerTypes(), "test_masker")
+	_, err = proxy.NewMasker("missing", nil)
+	assert.EqualError(t, err, `unknown masker type "missing"`)
+}
+
+func TestRegistry_RegisterTwice(t *testing.T) {
+	assert.Panics(t, func() {
+		proxy.RegisterBlocker("test_options", nil)
+	})
+	assert.Panics(t, func() {
+		proxy.RegisterMasker("test_masker", nil)
+	})
+}
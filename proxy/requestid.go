@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// DefaultRequestIDHeader carries the request ID when no other header is set
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the length of the longest incoming ID accepted
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestIDHeader sets the header the request ID is read from, forwarded upstream and
+// returned in, DefaultRequestIDHeader by default.
+func WithRequestIDHeader(name string) Option {
+	return func(st *state) {
+		st.requestIDHeader = http.CanonicalHeaderKey(name)
+	}
+}
+
+// withRequestID accepts the incoming request ID or generates one, sets it in the request and the
+// response, and adds it to the logger carried by the request context.
+func (rp *ReverseProxy) withRequestID(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := rp.requestState(r.Context()).requestIDHeader
+		id := r.Header.Get(header)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(header, id)
+		}
+		w.Header().Set(header, id)
+		log := rp.log.With().Str("request_id", id).Logger()
+		ctx := context.WithValue(log.WithContext(r.Context()), requestIDKey{}, id)
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// requestID returns the ID of the request of ctx
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether an incoming id can be logged and forwarded as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// Visible ASCII only, the ID ends up in log lines and headers
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
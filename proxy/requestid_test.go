@@ -0,0 +1,98 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_RequestID(t *testing.T) {
+	var upstreamID string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get("X-Request-ID") + r.Header.Get("X-Correlation-ID")
+		// The upstream ID is replaced by the proxy one
+		w.Header().Set("X-Request-ID", "upstream")
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	var out syncBuffer
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8092,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.New(&out))
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	tests := map[string]struct {
+		header    string
+		id        string
+		generated bool
+	}{
+		"Incoming": {
+			header: "X-Request-ID",
+			id:     "f47ac10b-58cc-4372-a567-0e02b2c3d479",
+		},
+		"Missing": {
+			header:    "X-Request-ID",
+			generated: true,
+		},
+		"Invalid": {
+			header:    "X-Request-ID",
+			id:        "id\tinjected",
+			generated: true,
+		},
+		"TooLong": {
+			header:    "X-Request-ID",
+			id:        strings.Repeat("a", 129),
+			generated: true,
+		},
+		"ConfiguredHeader": {
+			header: "X-Correlation-ID",
+			id:     "correlation-1",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			blocker := &MockBlocker{fn: func() (bool, error) { return true, nil }, monitor: true}
+			require.NoError(t, reverseProxy.Reload(targetServer.URL, []proxy.Masker{}, []proxy.Blocker{blocker},
+				proxy.WithRequestIDHeader(tt.header)))
+			out.Reset()
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:8092/hello", nil)
+			require.NoError(t, err)
+			if tt.id != "" {
+				req.Header.Set(tt.header, tt.id)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			id := resp.Header.Get(tt.header)
+			assert.Len(t, resp.Header.Values(tt.header), 1)
+			if tt.generated {
+				assert.Regexp(t, `^[0-9a-f]{32}$`, id)
+			} else {
+				assert.Equal(t, tt.id, id)
+			}
+			assert.Equal(t, id, upstreamID)
+			// The blocker line and the access log line
+			assert.Eventually(t, func() bool { return strings.Count(out.String(), "\n") == 2 }, time.Second,
+				10*time.Millisecond)
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var entry map[string]interface{}
+				require.NoError(t, json.Unmarshal([]byte(line), &entry))
+				assert.Equal(t, id, entry["request_id"], line)
+			}
+		})
+	}
+}
@@ -4,15 +4,23 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"reverseproxy/internal/accesslog"
+	"reverseproxy/internal/scan"
+	"reverseproxy/internal/tracing"
+
 	"github.com/rs/zerolog"
 )
 
@@ -28,16 +36,79 @@ type Masker interface {
 	Name() string
 }
 
+// Monitorable is implemented by blockers and maskers that can run in monitor mode,
+// where they are evaluated and logged without affecting the request or response.
+type Monitorable interface {
+	MonitorOnly() bool
+}
+
+// MatchCounter is implemented by maskers that can report how many values they would mask.
+type MatchCounter interface {
+	CountMatches(ctx context.Context, text []byte) int
+}
+
+// ScanRuleMasker is implemented by maskers whose patterns can be applied together with the
+// patterns of other maskers in a single pass over the body.
+type ScanRuleMasker interface {
+	ScanRules() []*scan.Rule
+}
+
+// ContentTypeFilter is implemented by maskers that only apply to some response content types.
+type ContentTypeFilter interface {
+	AppliesTo(contentType string) bool
+}
+
 // ReverseProxy ...
 type ReverseProxy struct {
-	TargetURL        string
-	Port             int
-	proxy            *httputil.ReverseProxy
-	proxyHandlerFunc func(p *httputil.ReverseProxy) func(http.ResponseWriter, *http.Request)
-	log              zerolog.Logger
+	// Deprecated: TargetURL is the target given to New, it is not updated by Reload. Use Target.
+	TargetURL string
+	Port      int
+	// TLSConfig serves the proxy over TLS when set, it must be set before Start
+	TLSConfig *tls.Config
+	// AccessLog writes an entry for every request, through the proxy logger when nil. Its
+	// redaction masks the logged values with the masker chain unless it has its own Mask.
+	// It must be set before Start
+	AccessLog *accesslog.Logger
+	// Tracer records a span for every request when set, it must be set before Start
+	Tracer    *tracing.Tracer
+	transport http.RoundTripper
+	log       zerolog.Logger
+
+	// state is swapped as a whole by Reload, every request keeps the state it started with
+	state atomic.Pointer[state]
 
+	// Deprecated: Blockers are the blockers given to New, changing them has no effect and they
+	// are not updated by Reload, which replaces the chains.
 	Blockers []Blocker
-	Maskers  []Masker
+	// Deprecated: Maskers are the maskers given to New, changing them has no effect and they
+	// are not updated by Reload, which replaces the chains.
+	Maskers []Masker
+}
+
+// state is the target and the blocker and masker chains used to serve a request
+type state struct {
+	target   *url.URL
+	proxy    *httputil.ReverseProxy
+	blockers []Blocker
+	maskers  []Masker
+
+	detokenization  *detokenization
+	policies        []Policy
+	requestIDHeader string
+	forwarding      Forwarding
+	headerRules     []HeaderRule
+	rewriteRules    []RewriteRule
+	// webSocketMasking masks the text messages of the WebSockets
+	webSocketMasking bool
+	streaming        Streaming
+	// scanRules are the rules of the maskers implementing ScanRuleMasker, scanIndex numbers them
+	scanRules map[Masker][]*scan.Rule
+	scanIndex map[Masker]int
+	// ruleMaskers are the names of the maskers of the scan rules
+	ruleMaskers map[*scan.Rule]string
+	// engines scan for the rules of consecutive maskers, keyed by their scanIndex
+	enginesMu sync.RWMutex
+	engines   map[string]*scan.Engine
 }
 
 // New creates a new reverse proxy
@@ -46,7 +117,8 @@ func New(
 	reverseProxyPort int,
 	m []Masker,
 	b []Blocker,
-	log zerolog.Logger) (*ReverseProxy, error) {
+	log zerolog.Logger,
+	opts ...Option) (*ReverseProxy, error) {
 
 	rp := &ReverseProxy{TargetURL: targetURL,
 		Port:     reverseProxyPort,
@@ -55,93 +127,331 @@ func New(
 		Blockers: b,
 	}
 
-	target, err := url.Parse(rp.TargetURL)
-	if err != nil {
+	transport := http.DefaultTransport.(*http.Transport)
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	// We can add later support for compression
+	transport.DisableCompression = true
+	rp.transport = transport
+
+	if err := rp.Reload(targetURL, m, b, opts...); err != nil {
 		return nil, err
 	}
-	rp.proxy = httputil.NewSingleHostReverseProxy(target)
-	rp.proxyHandlerFunc = func(p *httputil.ReverseProxy) func(http.ResponseWriter, *http.Request) {
-		return func(w http.ResponseWriter, r *http.Request) {
-			r.Host = target.Host
-			ctx := r.Context()
-			for _, b := range rp.Blockers {
-				if ok, err := b.Block(ctx, r); err != nil {
-					log.Info().Err(err).Str("blocker_name", b.Name()).Msg("blocker error")
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				} else if ok {
-					log.Info().Str("blocker_name", b.Name()).Msg("request blocked")
-					http.Error(w, "blocked", http.StatusForbidden)
-					return
-				}
-			}
-			p.ServeHTTP(w, r)
-		}
+	return rp, nil
+}
+
+// Reload atomically replaces the target, the masker and blocker chains and the options.
+// In-flight requests finish with the previous ones, on error the current ones are kept.
+func (rp *ReverseProxy) Reload(targetURL string, m []Masker, b []Blocker, opts ...Option) error {
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		return err
+	}
+	st := &state{
+		target:          target,
+		blockers:        b,
+		maskers:         m,
+		requestIDHeader: DefaultRequestIDHeader,
+		forwarding:      DefaultForwarding,
+		streaming:       DefaultStreaming,
+	}
+	st.proxy = httputil.NewSingleHostReverseProxy(target)
+	st.proxy.Director = st.director(st.proxy.Director)
+	st.proxy.Transport = tracingTransport{rp.transport}
+	st.proxy.ErrorHandler = rp.errorHandler
+	st.proxy.ModifyResponse = st.modifyResponse
+	for _, opt := range opts {
+		opt(st)
 	}
+	st.scanRules = map[Masker][]*scan.Rule{}
+	st.scanIndex = map[Masker]int{}
+	st.ruleMaskers = map[*scan.Rule]string{}
+	st.engines = map[string]*scan.Engine{}
+	st.addScanRules(st.maskers)
+	for _, p := range st.policies {
+		st.addScanRules(p.Maskers)
+	}
+	// Content types filtering maskers out add their engines when first masked
+	st.addEngines(st.maskers)
+	for _, p := range st.policies {
+		st.addEngines(p.Maskers)
+	}
+	rp.state.Store(st)
+	return nil
+}
 
-	rp.proxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
-		log.Error().Err(err).Msg("proxy handler error")
-		if _, ok := err.(*net.OpError); ok {
-			rw.WriteHeader(http.StatusBadGateway)
-			rw.Write([]byte{})
+// Target returns the URL of the target server requests are currently forwarded to
+func (rp *ReverseProxy) Target() string {
+	return rp.state.Load().target.String()
+}
+
+// stateKey is the context key of the state serving a request
+type stateKey struct{}
+
+// withState serves the request with the current state, a reload doesn't change it mid-request
+func (rp *ReverseProxy) withState(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), stateKey{}, rp.state.Load())))
+	}
+}
+
+// requestState returns the state serving the request of ctx, the current one outside of requests
+func (rp *ReverseProxy) requestState(ctx context.Context) *state {
+	if st, ok := ctx.Value(stateKey{}).(*state); ok {
+		return st
+	}
+	return rp.state.Load()
+}
+
+func (rp *ReverseProxy) handle(w http.ResponseWriter, r *http.Request) {
+	st := rp.requestState(r.Context())
+	hw := &headerRulesWriter{ResponseWriter: w, rules: st.matchHeaderRules(r)}
+	if st.block(hw, r) {
+		return
+	}
+	// Policies and header rules match the rewritten URL
+	rewritten, redirected := st.rewrite(hw, r)
+	if redirected {
+		return
+	}
+	if rewritten.URL.Path != r.URL.Path || rewritten.URL.RawQuery != r.URL.RawQuery {
+		hw.rules = st.matchHeaderRules(rewritten)
+		// The blockers evaluate the URL forwarded as well, a rewrite must not get past them
+		if st.block(hw, rewritten) {
 			return
 		}
-		if _, ok := err.(*url.Error); ok {
-			rw.WriteHeader(http.StatusBadGateway)
-			rw.Write([]byte{})
-			return
+	}
+	r = withHeaderRules(st.selectMaskers(rewritten), hw.rules)
+	st.proxy.ServeHTTP(hw, r)
+}
+
+// block evaluates the blockers and responds to the blocked requests, it reports whether r was blocked
+func (st *state) block(w http.ResponseWriter, r *http.Request) bool {
+	// Blockers and maskers log through the logger carried by the request context
+	ctx, span := tracing.Start(r.Context(), "blockers", tracing.KindInternal)
+	defer span.End()
+	log := zerolog.Ctx(ctx)
+	var monitored []string
+	defer func() {
+		if len(monitored) > 0 {
+			span.SetAttribute("blocker.monitored_matched", monitored)
+		}
+	}()
+	for _, b := range st.blockers {
+		if isMonitored(b) {
+			if monitorBlocker(ctx, b, r) {
+				monitored = append(monitored, b.Name())
+			}
+			continue
+		}
+		if ok, err := b.Block(ctx, r); err != nil {
+			log.Info().Err(err).Str("blocker_name", b.Name()).Msg("blocker error")
+			span.SetError(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		} else if ok {
+			log.Info().Str("blocker_name", b.Name()).Msg("request blocked")
+			span.SetAttribute("blocker.matched", []string{b.Name()})
+			http.Error(w, "blocked", http.StatusForbidden)
+			return true
 		}
-		rw.WriteHeader(http.StatusInternalServerError)
+	}
+	return false
+}
+
+func (rp *ReverseProxy) errorHandler(rw http.ResponseWriter, r *http.Request, err error) {
+	zerolog.Ctx(r.Context()).Error().Err(err).Msg("proxy handler error")
+	if _, ok := err.(*net.OpError); ok {
+		rw.WriteHeader(http.StatusBadGateway)
+		rw.Write([]byte{})
+		return
+	}
+	if _, ok := err.(*url.Error); ok {
+		rw.WriteHeader(http.StatusBadGateway)
 		rw.Write([]byte{})
+		return
 	}
+	rw.WriteHeader(http.StatusInternalServerError)
+	rw.Write([]byte{})
+}
 
-	rp.proxy.Transport = http.DefaultTransport
-	rp.proxy.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	// We can add later support for compression
-	rp.proxy.Transport.(*http.Transport).DisableCompression = true
-
-	rp.proxy.ModifyResponse = func(r *http.Response) error {
-		// Only inspect request with GET method
-		ctx := r.Request.Context()
-		if r.Request.Method == http.MethodGet {
-			// read response body
-			resBody, err := io.ReadAll(r.Body)
-			if err != nil {
-				return err
+func (st *state) modifyResponse(r *http.Response) error {
+	// The response carries the request ID set by the proxy
+	r.Header.Del(st.requestIDHeader)
+	if st.forwarding.sets(HeaderVia) {
+		appendHeader(r.Header, HeaderVia, st.forwarding.via(r.ProtoMajor, r.ProtoMinor))
+	}
+	// The body of a protocol switch is the upgraded connection, it is never read whole
+	if r.StatusCode == http.StatusSwitchingProtocols {
+		// The switch is written on the hijacked connection, past the headerRulesWriter
+		applyResponseHeaderRules(r.Request.Context(), r.Header)
+		conn, ok := r.Body.(io.ReadWriteCloser)
+		if ok && st.webSocketMasking && isWebSocket(r.Header) {
+			ctx := r.Request.Context()
+			maskers := applicable(st.maskersFor(ctx), "")
+			r.Body = maskWebSocket(ctx, conn, func(ctx context.Context, text []byte) ([]byte, error) {
+				return st.mask(ctx, maskers, text)
+			})
+		}
+		return nil
+	}
+	// Only inspect request with GET method
+	if r.Request.Method == http.MethodGet {
+		contentType := r.Header.Get("Content-Type")
+		if st.streaming.streams(contentType) {
+			ctx := r.Request.Context()
+			maskers := applicable(st.maskersFor(ctx), contentType)
+			// Masking changes the size of the events, the response is sent chunked
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = maskStream(ctx, r.Body, contentType, func(ctx context.Context, text []byte) ([]byte, error) {
+				return st.mask(ctx, maskers, text)
+			})
+			return nil
+		}
+		// read response body
+		resBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		ctx, span := tracing.Start(r.Request.Context(), "mask", tracing.KindInternal)
+		defer span.End()
+		masked, err := st.mask(ctx, applicable(st.maskersFor(ctx), contentType), resBody)
+		if err != nil {
+			span.SetError(err)
+			// We can leak some sensitive information if we dont return an error here
+			return err
+		}
+		// Masking changes the length of the values, e.g. when they are replaced with tokens
+		r.Body = io.NopCloser(bytes.NewReader(masked))
+		r.ContentLength = int64(len(masked))
+		r.Header.Set("Content-Length", strconv.Itoa(len(masked)))
+	}
+	return nil
+}
+
+// applicable returns the maskers that apply to contentType
+func applicable(maskers []Masker, contentType string) []Masker {
+	var res []Masker
+	for _, m := range maskers {
+		if f, ok := m.(ContentTypeFilter); ok && !f.AppliesTo(contentType) {
+			continue
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+// mask applies maskers to body. Consecutive maskers with scan rules are applied together in a
+// single pass. The names of the maskers that changed body are set on the span of ctx.
+func (st *state) mask(ctx context.Context, maskers []Masker, body []byte) ([]byte, error) {
+	span := tracing.SpanFromContext(ctx)
+	var changed []string
+	addChanged := func(name string) {
+		for _, c := range changed {
+			if c == name {
+				return
 			}
-			var masked []byte
-			masked = resBody
-			for _, m := range rp.Maskers {
-				masked, err = m.Mask(ctx, masked)
-				if err != nil {
-					log.Err(err).Str("masker_name", m.Name()).Msg("masker error")
-					// We can leak some sensitive information if we dont return an error here
-					return err
-				}
+		}
+		changed = append(changed, name)
+	}
+	var pending []Masker
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		matches := st.engine(pending).Find(body)
+		masked, err := scan.ReplaceMatches(ctx, body, matches)
+		if err != nil {
+			names := make([]string, len(pending))
+			for i, m := range pending {
+				names[i] = m.Name()
 			}
-			r.Body = io.NopCloser(bytes.NewReader(masked))
+			zerolog.Ctx(ctx).Err(err).Strs("masker_names", names).Msg("masker error")
+			return err
 		}
+		if span != nil {
+			for _, m := range matches {
+				addChanged(st.ruleMaskers[m.Rule])
+			}
+		}
+		body, pending = masked, pending[:0]
 		return nil
 	}
-
-	return rp, nil
+	for _, m := range maskers {
+		if isMonitored(m) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			monitorMasker(ctx, m, body)
+			continue
+		}
+		if len(st.scanRules[m]) > 0 {
+			pending = append(pending, m)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		masked, err := m.Mask(ctx, body)
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("masker_name", m.Name()).Msg("masker error")
+			return nil, err
+		}
+		if span != nil && !bytes.Equal(masked, body) {
+			addChanged(m.Name())
+		}
+		body = masked
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		span.SetAttribute("masker.changed", changed)
+	}
+	return body, nil
 }
 
 // Start start server exit if any error occurs
 func (rp *ReverseProxy) Start() (cancel func(), err error) {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", withLoggingHandlerFunc(rp.log, rp.proxyHandlerFunc(rp.proxy)))
+	al := rp.AccessLog
+	if al == nil {
+		al = accesslog.FromLogger(rp.log)
+	}
+	if al.Redaction.Mask == nil {
+		al.Redaction.Mask = rp.maskLog
+	}
+	handler := rp.handle
+	if rp.Tracer != nil {
+		handler = rp.withTracing(handler)
+	}
+	proxyHandler := rp.withLoggingHandlerFunc(al, handler)
+	mux.HandleFunc("/", rp.withState(rp.withRequestID(func(w http.ResponseWriter, r *http.Request) {
+		// Detokenization responses carry the original values, they are never logged
+		if dt := rp.requestState(r.Context()).detokenization; dt != nil && r.URL.Path == dt.path {
+			dt.ServeHTTP(w, r)
+			return
+		}
+		proxyHandler(w, r)
+	})))
 	// wait for sigint or sigterm to kill server
 	q := make(chan struct{})
 	cancel = func() {
 		q <- struct{}{}
 	}
 	srv := http.Server{
-		Addr:    fmt.Sprintf(":%d", rp.Port),
-		Handler: mux,
+		Addr:      fmt.Sprintf(":%d", rp.Port),
+		Handler:   mux,
+		TLSConfig: rp.TLSConfig,
 	}
 	go func() {
-		err := srv.ListenAndServe()
+		var err error
+		if srv.TLSConfig != nil {
+			// The certificates are in TLSConfig
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
 		if err != nil && err != http.ErrServerClosed {
 			rp.log.Fatal().Err(err).Msg("server error")
 		}
@@ -158,69 +468,127 @@ func (rp *ReverseProxy) Start() (cancel func(), err error) {
 	return cancel, nil
 }
 
-func withLoggingHandlerFunc(log zerolog.Logger, handler http.HandlerFunc) http.HandlerFunc {
-	loggingFn := func(rw http.ResponseWriter, req *http.Request) {
-		// Create custom response writer
-		lrw := &loggingResponseWriter{rw, 0, nil}
-		// Create a buffer to log the req body the content
-		var reqBodyBuffer strings.Builder
-		reqBodyTeeReader := io.TeeReader(req.Body, &reqBodyBuffer)
-		req.Body = io.NopCloser(reqBodyTeeReader)
-		start := time.Now()
-		// Call handler
-		handler.ServeHTTP(lrw, req)
-		duration := time.Since(start)
-		go func() {
-			// Read response body
-			defer lrw.body.Close()
-			resBody, _ := io.ReadAll(lrw.body)
-
-			dicReqHeader := zerolog.Dict()
-			for name, values := range req.Header {
-				for _, value := range values {
-					dicReqHeader.Str(name, value)
-				}
-			}
-			dicResHeader := zerolog.Dict()
-			for name, values := range lrw.Header() {
-				for _, value := range values {
-					dicResHeader.Str(name, value)
-				}
+// addScanRules keeps the rules of the maskers implementing ScanRuleMasker, they are analyzed once
+func (st *state) addScanRules(maskers []Masker) {
+	for _, m := range maskers {
+		sr, ok := m.(ScanRuleMasker)
+		// Maskers are map keys, skip the ones that can't be
+		if !ok || !reflect.TypeOf(m).Comparable() {
+			continue
+		}
+		if _, ok := st.scanRules[m]; !ok {
+			st.scanIndex[m] = len(st.scanIndex)
+			st.scanRules[m] = sr.ScanRules()
+			for _, r := range st.scanRules[m] {
+				st.ruleMaskers[r] = m.Name()
 			}
-			log.Debug().
-				Dur("duration_ms", duration).
-				Int("status", lrw.statusCode).
-				Str("method", req.Method).
-				Str("path", req.URL.Path).
-				Str("host", req.Host).
-				Str("remote_addr", req.RemoteAddr).
-				Str("user_agent", req.UserAgent()).
-				Dict("response_headers", dicResHeader).
-				Dict("request_headers", dicReqHeader).
-				Str("request_body", reqBodyBuffer.String()).
-				Str("response_body", string(resBody)).
-				Msg("request received")
-		}()
+		}
+	}
+}
+
+// addEngines builds the engines of the consecutive maskers with scan rules in maskers
+func (st *state) addEngines(maskers []Masker) {
+	start := 0
+	for i, m := range maskers {
+		if !isMonitored(m) && len(st.scanRules[m]) > 0 {
+			continue
+		}
+		if i > start {
+			st.engine(maskers[start:i])
+		}
+		start = i + 1
+	}
+	if start < len(maskers) {
+		st.engine(maskers[start:])
+	}
+}
+
+// engine returns the engine scanning for the rules of maskers, building it on first use
+func (st *state) engine(maskers []Masker) *scan.Engine {
+	var buf [32]byte
+	key := buf[:0]
+	for _, m := range maskers {
+		key = binary.AppendUvarint(key, uint64(st.scanIndex[m]))
+	}
+	st.enginesMu.RLock()
+	e := st.engines[string(key)]
+	st.enginesMu.RUnlock()
+	if e != nil {
+		return e
 	}
-	return http.HandlerFunc(loggingFn)
+	var rules []*scan.Rule
+	for _, m := range maskers {
+		rules = append(rules, st.scanRules[m]...)
+	}
+	e = scan.New(rules...)
+	st.enginesMu.Lock()
+	st.engines[string(key)] = e
+	st.enginesMu.Unlock()
+	return e
 }
 
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
-	body       io.ReadCloser
+func isMonitored(v interface{}) bool {
+	m, ok := v.(Monitorable)
+	return ok && m.MonitorOnly()
 }
 
-func (lrw *loggingResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
-	lrw.ResponseWriter.WriteHeader(code)
+// monitorBlocker evaluates b and logs its verdict, the request always proceeds. It reports
+// whether b would block the request.
+func monitorBlocker(ctx context.Context, b Blocker, r *http.Request) bool {
+	log := zerolog.Ctx(ctx)
+	ok, err := b.Block(ctx, r)
+	if err != nil {
+		log.Info().Err(err).Str("blocker_name", b.Name()).Msg("monitored blocker error")
+		return false
+	}
+	if ok {
+		log.Warn().Str("blocker_name", b.Name()).Msg("request would be blocked")
+	}
+	return ok
 }
 
-func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
-	lrw.body = io.NopCloser(bytes.NewReader(b))
-	return lrw.ResponseWriter.Write(b)
+// monitorMasker evaluates m against text and logs what it would mask, text is left untouched.
+func monitorMasker(ctx context.Context, m Masker, text []byte) {
+	log := zerolog.Ctx(ctx)
+	masked, err := m.Mask(ctx, text)
+	if err != nil {
+		log.Info().Err(err).Str("masker_name", m.Name()).Msg("monitored masker error")
+		return
+	}
+	if bytes.Equal(masked, text) {
+		return
+	}
+	event := log.Warn().Str("masker_name", m.Name())
+	if c, ok := m.(MatchCounter); ok {
+		event = event.Int("matches", c.CountMatches(ctx, text))
+	}
+	event.Msg("response would be masked")
 }
 
-func (lrw *loggingResponseWriter) Header() http.Header {
-	return lrw.ResponseWriter.Header()
+// logMaskingKey marks the contexts of the values masked for the access log
+type logMaskingKey struct{}
+
+// MasksLog reports whether ctx masks a value for the access log rather than a response, tokenizers
+// keeping the original values must not keep the ones that are only logged.
+func MasksLog(ctx context.Context) bool {
+	masksLog, _ := ctx.Value(logMaskingKey{}).(bool)
+	return masksLog
+}
+
+// maskLog applies the masker chain serving the request to a logged value, whatever the content
+// type or the policy of the request. Monitored maskers are skipped, the value is redacted if a
+// masker fails.
+func (rp *ReverseProxy) maskLog(ctx context.Context, text []byte) []byte {
+	st := rp.requestState(ctx)
+	var maskers []Masker
+	for _, m := range st.maskers {
+		if !isMonitored(m) {
+			maskers = append(maskers, m)
+		}
+	}
+	masked, err := st.mask(context.WithValue(ctx, logMaskingKey{}, true), maskers, text)
+	if err != nil {
+		return []byte(accesslog.Redacted)
+	}
+	return masked
 }
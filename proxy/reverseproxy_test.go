@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	masks "reverseproxy/internal/masker"
 	"reverseproxy/proxy"
 
 	"github.com/rs/zerolog"
@@ -51,6 +55,7 @@ func TestReverseProxy(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	waitListening(t, reverseProxy.Port)
 	req, err := http.NewRequest(http.MethodGet, "http://localhost:8080", nil)
 	require.NoError(t, err)
 	client := http.Client{}
@@ -125,6 +130,7 @@ func TestReverseProxy_NoTargetSever(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	waitListening(t, reverseProxy.Port)
 	req, err := http.NewRequest(http.MethodGet, "http://localhost:8081", nil)
 	require.NoError(t, err)
 	client := http.Client{}
@@ -133,8 +139,157 @@ func TestReverseProxy_NoTargetSever(t *testing.T) {
 	require.Equal(t, http.StatusBadGateway, resp.StatusCode, "invalid status code")
 }
 
+func TestReverseProxy_Monitor(t *testing.T) {
+	masker := &MockMasker{
+		fn: func(text []byte) ([]byte, error) {
+			return []byte("Masked"), nil
+		},
+		monitor: true,
+	}
+	blocker := &MockBlocker{
+		fn: func() (bool, error) {
+			return true, nil
+		},
+		monitor: true,
+	}
+	targetServerResponse := "Hello World"
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(targetServerResponse))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8082,
+		[]proxy.Masker{masker},
+		[]proxy.Blocker{blocker},
+		zerolog.Nop())
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	client := http.Client{}
+	t.Run("monitored blocker and masker do not alter the request", func(t *testing.T) {
+		resp, err := client.Get("http://localhost:8082")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, "invalid status code")
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(resp.Body)
+		assert.Equal(t, targetServerResponse, buf.String(), "invalid response body")
+	})
+	t.Run("monitored blocker error does not fail the request", func(t *testing.T) {
+		blocker.fn = func() (bool, error) {
+			return false, errors.New("blocker error")
+		}
+		masker.fn = func(text []byte) ([]byte, error) {
+			return nil, errors.New("masker error")
+		}
+		resp, err := client.Get("http://localhost:8082")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, "invalid status code")
+	})
+}
+
+func TestReverseProxy_Reload(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8083,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	client := http.Client{}
+	resp, err := client.Get("http://localhost:8083")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, "invalid status code")
+
+	t.Run("reload swaps blockers", func(t *testing.T) {
+		blocker := &MockBlocker{
+			fn: func() (bool, error) {
+				return true, nil
+			},
+		}
+		err := reverseProxy.Reload(targetServer.URL, []proxy.Masker{}, []proxy.Blocker{blocker})
+		require.NoError(t, err)
+		resp, err := client.Get("http://localhost:8083")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, "invalid status code")
+	})
+	t.Run("invalid reload keeps the current config", func(t *testing.T) {
+		err := reverseProxy.Reload("://invalid", []proxy.Masker{}, []proxy.Blocker{})
+		require.Error(t, err)
+		resp, err := client.Get("http://localhost:8083")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, "invalid status code")
+		assert.Equal(t, targetServer.URL, reverseProxy.Target())
+	})
+}
+
+func TestReverseProxy_MaskerContentTypes(t *testing.T) {
+	masker := &MockMasker{
+		fn: func(text []byte) ([]byte, error) {
+			return []byte("Masked"), nil
+		},
+		contentTypes: []string{"application/json"},
+	}
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("ct"))
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8084,
+		[]proxy.Masker{masker},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	client := http.Client{}
+	tests := map[string]struct {
+		contentType string
+		expected    string
+	}{
+		"matching content type":     {contentType: "application/json", expected: "Masked"},
+		"not matching content type": {contentType: "image/png", expected: "Hello World"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.Get("http://localhost:8084/?ct=" + tt.contentType)
+			require.NoError(t, err)
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(resp.Body)
+			assert.Equal(t, tt.expected, buf.String(), "invalid response body")
+		})
+	}
+}
+
+// waitListening waits for the proxy started in the background to accept connections
+func waitListening(t *testing.T, port int) {
+	t.Helper()
+	addr := fmt.Sprintf("localhost:%d", port)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
 type MockMasker struct {
-	fn func([]byte) ([]byte, error)
+	fn           func([]byte) ([]byte, error)
+	monitor      bool
+	contentTypes []string
 }
 
 func (m *MockMasker) Mask(ctx context.Context, text []byte) ([]byte, error) {
@@ -145,8 +300,25 @@ func (m *MockMasker) Name() string {
 	return "Test Masker"
 }
 
+func (m *MockMasker) MonitorOnly() bool {
+	return m.monitor
+}
+
+func (m *MockMasker) AppliesTo(contentType string) bool {
+	if len(m.contentTypes) == 0 {
+		return true
+	}
+	for _, ct := range m.contentTypes {
+		if ct == contentType {
+			return true
+		}
+	}
+	return false
+}
+
 type MockBlocker struct {
-	fn func() (bool, error)
+	fn      func() (bool, error)
+	monitor bool
 }
 
 func (b *MockBlocker) Block(ctx context.Context, r *http.Request) (bool, error) {
@@ -156,3 +328,38 @@ func (b *MockBlocker) Block(ctx context.Context, r *http.Request) (bool, error)
 func (b *MockBlocker) Name() string {
 	return "Test Blocker"
 }
+
+func (b *MockBlocker) MonitorOnly() bool {
+	return b.monitor
+}
+
+func TestReverseProxy_ScanRules(t *testing.T) {
+	// Scan rule maskers are applied in a single pass, keeping their order with the other maskers
+	upper := &MockMasker{
+		fn: func(text []byte) ([]byte, error) {
+			return bytes.ToUpper(text), nil
+		},
+	}
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mail ann@example.com, card 4012-8888-8888-1881, ip 10.0.0.1"))
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8087,
+		[]proxy.Masker{masks.NewEmailMasker(), masks.NewCreditCardMasker(), upper, masks.NewIPMasker()},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	resp, err := http.Get("http://localhost:8087/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(resp.Body)
+	// The masked email is longer, the length of the response is updated
+	assert.Equal(t, "MAIL ****@EXAMPLE.COM, CARD ****-****-****-****, IP **.*.*.*", buf.String())
+	assert.Equal(t, int64(buf.Len()), resp.ContentLength)
+}
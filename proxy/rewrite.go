@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// RewriteRule rewrites the URL of the requests whose path matches Pattern before they are
+// forwarded, or redirects them.
+type RewriteRule struct {
+	Pattern *regexp.Regexp
+	// Replacement replaces the whole path, $1 or ${name} expand to the groups of Pattern.
+	// The path is kept when empty. Redirects require it and can replace it with an absolute URL
+	Replacement string
+	// AddQuery sets query parameters
+	AddQuery map[string]string
+	// RemoveQuery deletes query parameters
+	RemoveQuery []string
+	// RedirectStatus responds with a redirect to the rewritten URL, 301, 302, 307 or 308, the
+	// request is not forwarded
+	RedirectStatus int
+	// Last stops the evaluation of the next rules when the rule matches
+	Last bool
+}
+
+// WithRewriteRules evaluates rules in order on the requests that were not blocked
+func WithRewriteRules(rules ...RewriteRule) Option {
+	return func(st *state) {
+		st.rewriteRules = rules
+	}
+}
+
+// rewrite applies the matching rules to a copy of r and returns it. Redirects are written to w
+// and reported, the returned request must not be forwarded then.
+func (st *state) rewrite(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	rewritten := false
+	for i := range st.rewriteRules {
+		rule := &st.rewriteRules[i]
+		match := rule.Pattern.FindStringSubmatchIndex(r.URL.Path)
+		if match == nil {
+			continue
+		}
+		if !rewritten {
+			// The logging middleware keeps the URL the client requested
+			r = r.WithContext(r.Context())
+			u := *r.URL
+			r.URL = &u
+			rewritten = true
+		}
+		if len(rule.AddQuery) > 0 || len(rule.RemoveQuery) > 0 {
+			q := r.URL.Query()
+			for _, name := range rule.RemoveQuery {
+				q.Del(name)
+			}
+			for name, value := range rule.AddQuery {
+				q.Set(name, value)
+			}
+			r.URL.RawQuery = q.Encode()
+		}
+		path := r.URL.Path
+		if rule.Replacement != "" {
+			path = string(rule.Pattern.ExpandString(nil, rule.Replacement, r.URL.Path, match))
+		}
+		if rule.RedirectStatus != 0 {
+			if !absoluteURL(rule.Replacement) {
+				path = localLocation(path)
+			}
+			// A redirect to a path the rule matches again never ends
+			if !strings.HasPrefix(path, "//") && strings.HasPrefix(path, "/") && rule.Pattern.MatchString(path) {
+				zerolog.Ctx(r.Context()).Error().Str("location", path).Msg("rewrite rule redirects to itself")
+				http.Error(w, "redirect loop", http.StatusInternalServerError)
+				return r, true
+			}
+			location := path
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, location, rule.RedirectStatus)
+			return r, true
+		}
+		r.URL.Path, r.URL.RawPath = path, ""
+		if rule.Last {
+			break
+		}
+	}
+	return r, false
+}
+
+// absoluteURL reports whether location is a URL with a scheme or a scheme-relative one
+func absoluteURL(location string) bool {
+	if strings.HasPrefix(location, "//") {
+		return true
+	}
+	i := strings.IndexAny(location, ":/?#$")
+	return i > 0 && location[i] == ':'
+}
+
+// localLocation keeps a location expanded from the client path on this host. Browsers follow the
+// locations starting with // or /\ to another host and ignore the tabs and newlines in them, these
+// leading characters are collapsed into one slash and a location with a scheme becomes a path.
+func localLocation(location string) string {
+	trimmed := strings.TrimLeft(location, "/\\\t\r\n")
+	if len(trimmed) < len(location) || absoluteURL(trimmed) {
+		return "/" + trimmed
+	}
+	return location
+}
@@ -0,0 +1,150 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"reverseproxy/internal/blocker"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_RewriteRules(t *testing.T) {
+	var upstreamURI string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamURI = r.RequestURI
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	rules := []proxy.RewriteRule{
+		{
+			Pattern:     regexp.MustCompile(`^/v1/users/(?P<id>\d+)$`),
+			Replacement: "/api/v2/users/${id}",
+			AddQuery:    map[string]string{"source": "v1"},
+			RemoveQuery: []string{"debug"},
+		},
+		{
+			Pattern:     regexp.MustCompile(`^/internal/(.*)$`),
+			Replacement: "/$1",
+		},
+		{
+			Pattern:        regexp.MustCompile(`^/legacy/(.*)$`),
+			Replacement:    "/new/$1",
+			RedirectStatus: http.StatusMovedPermanently,
+		},
+		{
+			Pattern:        regexp.MustCompile(`^/old-site/(.*)$`),
+			Replacement:    "https://example.com/$1",
+			RedirectStatus: http.StatusPermanentRedirect,
+		},
+		{
+			Pattern:        regexp.MustCompile(`^/go(.*)$`),
+			Replacement:    "/$1",
+			RedirectStatus: http.StatusFound,
+		},
+		{
+			Pattern:        regexp.MustCompile(`^/to/(.*)$`),
+			Replacement:    "$1",
+			RedirectStatus: http.StatusFound,
+		},
+		{
+			Pattern:        regexp.MustCompile(`^/moved$`),
+			AddQuery:       map[string]string{"moved": "1"},
+			RedirectStatus: http.StatusMovedPermanently,
+		},
+		{
+			Pattern:  regexp.MustCompile(`^/api/`),
+			AddQuery: map[string]string{"version": "2"},
+			Last:     true,
+		},
+		{
+			Pattern:  regexp.MustCompile(`^/api/`),
+			AddQuery: map[string]string{"skipped": "1"},
+		},
+	}
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8096,
+		[]proxy.Masker{},
+		[]proxy.Blocker{&blocker.PathBlocker{Path: []string{"/admin"}}},
+		zerolog.Nop(),
+		proxy.WithRewriteRules(rules...))
+	require.NoError(t, err)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	tests := map[string]struct {
+		uri              string
+		expectedStatus   int
+		expectedUpstream string
+		expectedLocation string
+	}{
+		"Rewrite": {
+			uri:              "/v1/users/42?debug=1&x=1",
+			expectedStatus:   http.StatusOK,
+			expectedUpstream: "/api/v2/users/42?source=v1&version=2&x=1",
+		},
+		"RewriteToBlockedPath": {
+			uri:            "/internal/admin",
+			expectedStatus: http.StatusForbidden,
+		},
+		"Redirect": {
+			uri:              "/legacy/orders?page=2",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/new/orders?page=2",
+		},
+		"AbsoluteRedirect": {
+			uri:              "/old-site/about",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "https://example.com/about",
+		},
+		"RedirectDoubleSlash": {
+			uri:              "/go/evil.com",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/evil.com",
+		},
+		"RedirectBackslash": {
+			uri:              "/go%5Cevil.com",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/evil.com",
+		},
+		"RedirectTab": {
+			uri:              "/go%09/evil.com",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/evil.com",
+		},
+		"RedirectScheme": {
+			uri:              "/to/javascript:alert(1)",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/javascript:alert(1)",
+		},
+		"RedirectLoop": {
+			uri:            "/moved",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"NoMatch": {
+			uri:              "/other?x=1",
+			expectedStatus:   http.StatusOK,
+			expectedUpstream: "/other?x=1",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			upstreamURI = ""
+			resp, err := client.Get("http://localhost:8096" + tt.uri)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tt.expectedUpstream, upstreamURI)
+			assert.Equal(t, tt.expectedLocation, resp.Header.Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"reverseproxy/internal/tracing"
+)
+
+// Streamed content types
+const (
+	ContentTypeEventStream = "text/event-stream"
+	ContentTypeNDJSON      = "application/x-ndjson"
+)
+
+// MaxStreamEvent is the largest event or line masked in a streamed response, the response is cut
+// when the target sends a larger one
+const MaxStreamEvent = 1 << 20
+
+// Streaming controls the responses passed through to the client as the target sends them.
+type Streaming struct {
+	// ContentTypes are the media types of the streamed responses. GET responses of these types are
+	// masked one Server-Sent Event at a time for text/event-stream, one line at a time otherwise
+	ContentTypes []string
+	// FlushInterval flushes the other responses to the client periodically while they are copied,
+	// after every write when negative and only at the end when 0. Streamed responses and responses
+	// of unknown length are flushed after every write
+	FlushInterval time.Duration
+}
+
+// DefaultStreaming streams Server-Sent Events and newline delimited JSON
+var DefaultStreaming = Streaming{
+	ContentTypes: []string{ContentTypeEventStream, ContentTypeNDJSON},
+}
+
+// WithStreaming sets the streamed responses, DefaultStreaming by default
+func WithStreaming(s Streaming) Option {
+	return func(st *state) {
+		st.streaming = s
+		st.proxy.FlushInterval = s.FlushInterval
+	}
+}
+
+// streams reports whether the responses with contentType are streamed
+func (s *Streaming) streams(contentType string) bool {
+	mediaType := mediaType(contentType)
+	for _, ct := range s.ContentTypes {
+		if strings.EqualFold(ct, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaType returns the media type of contentType without its parameters
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mt
+}
+
+// maskStream returns body with every event, or every line, masked by mask as soon as it is read
+func maskStream(ctx context.Context, body io.ReadCloser, contentType string,
+	mask func(ctx context.Context, text []byte) ([]byte, error)) io.ReadCloser {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, MaxStreamEvent)
+	if mediaType(contentType) == ContentTypeEventStream {
+		scanner.Split(scanEvents)
+	} else {
+		scanner.Split(scanLines)
+	}
+	return &streamReader{ReadCloser: body, ctx: ctx, mask: mask, scanner: scanner}
+}
+
+// streamReader masks the events of a streamed body one at a time
+type streamReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	mask    func(ctx context.Context, text []byte) ([]byte, error)
+	scanner *bufio.Scanner
+	// out is the masked event ready to be read
+	out bytes.Buffer
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if err := r.maskEvent(r.scanner.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return r.out.Read(p)
+}
+
+func (r *streamReader) maskEvent(event []byte) error {
+	ctx, span := tracing.Start(r.ctx, "mask", tracing.KindInternal)
+	defer span.End()
+	masked, err := r.mask(ctx, event)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	r.out.Write(masked)
+	return nil
+}
+
+// scanLines splits a stream in lines, keeping their end of line
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// scanEvents splits a stream in Server-Sent Events, each one ending with a blank line that is kept
+func scanEvents(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for {
+		i := bytes.IndexByte(data[start:], '\n')
+		if i < 0 {
+			break
+		}
+		line := data[start : start+i]
+		start += i + 1
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\r') {
+			return start, data[:start], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,103 @@
+package proxy_test
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reverseproxy/internal/accesslog"
+	masks "reverseproxy/internal/masker"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_Streaming(t *testing.T) {
+	release := make(chan struct{})
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: mail john@example.com\r\n\r\n"))
+		case "/lines":
+			w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+			w.Write([]byte(`{"mail":"john@example.com"}` + "\n"))
+		case "/leave":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(": connected\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.(http.Flusher).Flush()
+		// The first event reaches the client before the target sends the next one
+		<-release
+		if r.URL.Path == "/events" {
+			w.Write([]byte("id: 2\ndata: card 4012-8888-8888-1881\n\n"))
+		} else {
+			w.Write([]byte(`{"card":"4012-8888-8888-1881"}`))
+		}
+	}))
+	defer targetServer.Close()
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8098,
+		[]proxy.Masker{masks.NewEmailMasker(), masks.NewCreditCardMasker()},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatCommon, nil, zerolog.InfoLevel, &out)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	tests := map[string]struct {
+		path     string
+		first    string
+		expected string
+	}{
+		"EventStream": {
+			path:     "/events",
+			first:    "data: mail ****@example.com\r\n\r\n",
+			expected: "id: 2\ndata: card ****-****-****-****\n\n",
+		},
+		"NDJSON": {
+			path:     "/lines",
+			first:    `{"mail":"****@example.com"}` + "\n",
+			expected: `{"card":"****-****-****-****"}`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get("http://localhost:8098" + tt.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Empty(t, resp.Header.Get("Content-Length"))
+			first := make([]byte, len(tt.first))
+			_, err = io.ReadFull(resp.Body, first)
+			require.NoError(t, err)
+			assert.Equal(t, tt.first, string(first))
+			release <- struct{}{}
+			rest, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(rest))
+		})
+	}
+	t.Run("ClientLeaves", func(t *testing.T) {
+		out.Reset()
+		resp, err := http.Get("http://localhost:8098/leave")
+		require.NoError(t, err)
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, ": connected\n", line)
+		resp.Body.Close()
+		// The response is cut, its entry is logged all the same
+		assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+		assert.Regexp(t, `"GET /leave HTTP/1\.1" 200 13\n$`, out.String())
+	})
+}
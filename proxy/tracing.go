@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"reverseproxy/internal/tracing"
+)
+
+// withTracing records a server span for the request, the child of the caller's span if any.
+// It runs inside the logging handler, the status is read from its writer.
+func (rp *ReverseProxy) withTracing(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.ContextWithRemoteSpanContext(ctx, sc)
+		}
+		ctx, span := rp.Tracer.Start(ctx, "proxy request", tracing.KindServer)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		if id := requestID(ctx); id != "" {
+			span.SetAttribute("request.id", id)
+		}
+		handler(w, r.WithContext(ctx))
+		if lrw, ok := w.(*loggingResponseWriter); ok {
+			status := lrw.status()
+			span.SetAttribute("http.status_code", status)
+			if status >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+			}
+		}
+	}
+}
+
+// tracingTransport records a client span for the upstream round trip and propagates it
+type tracingTransport struct {
+	http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), "upstream", tracing.KindClient)
+	if span == nil {
+		return t.RoundTripper.RoundTrip(req)
+	}
+	defer span.End()
+	outreq := req.Clone(ctx)
+	tracing.Inject(outreq.Header, span.SpanContext())
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	resp, err := t.RoundTripper.RoundTrip(outreq)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	// The response is masked in the span of the request, not the upstream one
+	resp.Request = req
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(errors.New(resp.Status))
+	}
+	return resp, nil
+}
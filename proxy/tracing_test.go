@@ -0,0 +1,146 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"reverseproxy/internal/tracing"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseProxy_Tracing(t *testing.T) {
+	collector := &otlpCollector{}
+	collectorServer := httptest.NewServer(collector)
+	defer collectorServer.Close()
+	var upstreamTraceparent string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+		w.Write([]byte("Hello World"))
+	}))
+	defer targetServer.Close()
+	masker := &MockMasker{
+		fn: func(b []byte) ([]byte, error) {
+			return bytes.ReplaceAll(b, []byte("World"), []byte("*****")), nil
+		},
+	}
+	blocker := &MockBlocker{fn: func() (bool, error) { return true, nil }, monitor: true}
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8093,
+		[]proxy.Masker{masker},
+		[]proxy.Blocker{blocker},
+		zerolog.Nop())
+	require.NoError(t, err)
+	tracer := tracing.NewTracer(tracing.NewOTLPExporter(collectorServer.URL+"/v1/traces", "reverseproxy", nil),
+		zerolog.Nop())
+	reverseProxy.Tracer = tracer
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8093/hello", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Request-ID", "req-1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := collector.spansByName()
+	require.Len(t, spans, 4)
+	server, blockers, upstream, mask := spans["proxy request"], spans["blockers"], spans["upstream"], spans["mask"]
+	for _, s := range spans {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID, s.Name)
+	}
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+	assert.Equal(t, 2, server.Kind)
+	assert.Equal(t, map[string]interface{}{"http.method": "GET", "url.path": "/hello", "request.id": "req-1",
+		"http.status_code": "200"}, server.attributes())
+	assert.Equal(t, server.SpanID, blockers.ParentSpanID)
+	assert.Equal(t, map[string]interface{}{"blocker.monitored_matched": []interface{}{"Test Blocker"}},
+		blockers.attributes())
+	assert.Equal(t, server.SpanID, upstream.ParentSpanID)
+	assert.Equal(t, 3, upstream.Kind)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+upstream.SpanID+"-01", upstreamTraceparent)
+	assert.Equal(t, server.SpanID, mask.ParentSpanID)
+	assert.Equal(t, map[string]interface{}{"masker.changed": []interface{}{"Test Masker"}}, mask.attributes())
+}
+
+// otlpCollector keeps the spans posted to it
+type otlpCollector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+type otlpSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func (c *otlpCollector) spansByName() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := map[string]otlpSpan{}
+	for _, s := range c.spans {
+		spans[s.Name] = s
+	}
+	return spans
+}
+
+// attributes returns the attribute values, arrays as their values
+func (s otlpSpan) attributes() map[string]interface{} {
+	attrs := map[string]interface{}{}
+	for _, a := range s.Attributes {
+		for _, v := range a.Value {
+			if array, ok := v.(map[string]interface{}); ok {
+				var values []interface{}
+				for _, av := range array["values"].([]interface{}) {
+					for _, value := range av.(map[string]interface{}) {
+						values = append(values, value)
+					}
+				}
+				v = values
+			}
+			attrs[a.Key] = v
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"reverseproxy/internal/tracing"
+)
+
+// MaxWebSocketMessage is the largest text message masked on a WebSocket, the connection is closed
+// when the target sends a larger one
+const MaxWebSocketMessage = 1 << 20
+
+// WebSocket opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+)
+
+// headerWebSocketExtensions negotiates the extensions of a WebSocket, e.g. compression
+const headerWebSocketExtensions = "Sec-WebSocket-Extensions"
+
+var errWebSocketCompressed = errors.New("compressed websocket text frame can't be masked")
+
+// WithWebSocketMasking masks the text messages the target sends on WebSockets with the maskers of
+// the request. Extensions are not negotiated with the target so messages are never compressed.
+func WithWebSocketMasking(enabled bool) Option {
+	return func(st *state) {
+		st.webSocketMasking = enabled
+	}
+}
+
+// isWebSocket reports whether h upgrades the connection to a WebSocket
+func isWebSocket(h http.Header) bool {
+	return headerHasToken(h, "Connection", "upgrade") && headerHasToken(h, "Upgrade", "websocket")
+}
+
+// headerHasToken reports whether the comma separated values of the header name contain token
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskWebSocket returns the upstream connection of a WebSocket with the text messages it reads masked
+// by mask. What the client sends is written unchanged.
+func maskWebSocket(ctx context.Context, conn io.ReadWriteCloser,
+	mask func(ctx context.Context, text []byte) ([]byte, error)) io.ReadWriteCloser {
+	return &webSocketConn{ReadWriteCloser: conn, ctx: ctx, mask: mask, r: bufio.NewReader(conn)}
+}
+
+// webSocketConn reads the frames of the target one at a time. Text messages are gathered from
+// their fragments and sent as a single masked frame, control and binary frames are passed through.
+type webSocketConn struct {
+	io.ReadWriteCloser
+	ctx  context.Context
+	mask func(ctx context.Context, text []byte) ([]byte, error)
+	r    *bufio.Reader
+
+	// out is ready to be read, followed by payload bytes read straight from r
+	out     bytes.Buffer
+	payload int64
+	// text is the current text message, inText is set until its last fragment
+	text   []byte
+	inText bool
+}
+
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	for c.out.Len() == 0 && c.payload == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if c.out.Len() > 0 {
+		return c.out.Read(p)
+	}
+	if int64(len(p)) > c.payload {
+		p = p[:c.payload]
+	}
+	n, err := c.r.Read(p)
+	c.payload -= int64(n)
+	if err == io.EOF && c.payload > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// CloseWrite half-closes the upstream connection when it supports it
+func (c *webSocketConn) CloseWrite() error {
+	if cw, ok := c.ReadWriteCloser.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return http.ErrNotSupported
+}
+
+// readFrame reads the header of the next frame. The frames of text messages are read whole,
+// the payload of the others is left in r.
+func (c *webSocketConn) readFrame() error {
+	var header [14]byte
+	if _, err := io.ReadFull(c.r, header[:2]); err != nil {
+		return err
+	}
+	size := 2
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.r, header[2:4]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(header[2:4]))
+		size = 4
+	case 127:
+		if _, err := io.ReadFull(c.r, header[2:10]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(header[2:10]) & (1<<63 - 1))
+		size = 10
+	}
+	masked := header[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(c.r, header[size:size+4]); err != nil {
+			return err
+		}
+		size += 4
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	text := opcode == opText || (opcode == opContinuation && c.inText)
+	if !text {
+		c.out.Write(header[:size])
+		c.payload = length
+		return nil
+	}
+	if opcode == opText && header[0]&0x70 != 0 {
+		return errWebSocketCompressed
+	}
+	if length > MaxWebSocketMessage-int64(len(c.text)) {
+		return fmt.Errorf("websocket text message larger than %d bytes", MaxWebSocketMessage)
+	}
+	start := len(c.text)
+	c.text = append(c.text, make([]byte, length)...)
+	if _, err := io.ReadFull(c.r, c.text[start:]); err != nil {
+		return err
+	}
+	if masked {
+		key := header[size-4 : size]
+		for i := range c.text[start:] {
+			c.text[start+i] ^= key[i%4]
+		}
+	}
+	c.inText = !fin
+	if fin {
+		return c.writeText()
+	}
+	return nil
+}
+
+// writeText masks the current text message and makes it ready to be read as a single frame
+func (c *webSocketConn) writeText() error {
+	ctx, span := tracing.Start(c.ctx, "mask", tracing.KindInternal)
+	defer span.End()
+	masked, err := c.mask(ctx, c.text)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	header := []byte{0x80 | opText, 0}
+	switch n := len(masked); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.out.Write(header)
+	c.out.Write(masked)
+	c.text = c.text[:0]
+	return nil
+}
@@ -0,0 +1,193 @@
+package proxy_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"reverseproxy/internal/accesslog"
+	masks "reverseproxy/internal/masker"
+	"reverseproxy/proxy"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsFrame is a WebSocket frame, the first byte holds the FIN bit and the opcode
+type wsFrame struct {
+	head    byte
+	payload string
+}
+
+func TestReverseProxy_WebSocket(t *testing.T) {
+	extensions := make(chan string, 1)
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensions <- r.Header.Get("Sec-WebSocket-Extensions")
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		brw.Flush()
+		echo, err := readFrame(brw.Reader)
+		if err != nil {
+			return
+		}
+		// A fragmented text message with a ping in between, a binary message and the echo
+		for _, f := range []wsFrame{
+			{0x01, "mail john"},
+			{0x89, ""},
+			{0x80, "@example.com"},
+			{0x82, "john@example.com"},
+			{0x81, echo.payload},
+		} {
+			conn.Write(appendFrame(nil, f, false))
+		}
+	}))
+	defer targetServer.Close()
+	tests := map[string]struct {
+		opts       []proxy.Option
+		blocked    bool
+		extensions string
+		expected   []wsFrame
+		sent       int
+	}{
+		"Masked": {
+			opts: []proxy.Option{proxy.WithWebSocketMasking(true)},
+			expected: []wsFrame{
+				{0x89, ""},
+				{0x81, "mail ****@example.com"},
+				{0x82, "john@example.com"},
+				{0x81, "hello"},
+			},
+			sent: 2 + 23 + 18 + 7,
+		},
+		"NotMasked": {
+			extensions: "permessage-deflate",
+			expected: []wsFrame{
+				{0x01, "mail john"},
+				{0x89, ""},
+				{0x80, "@example.com"},
+				{0x82, "john@example.com"},
+				{0x81, "hello"},
+			},
+			sent: 11 + 2 + 14 + 18 + 7,
+		},
+		"Blocked": {
+			opts:    []proxy.Option{proxy.WithWebSocketMasking(true)},
+			blocked: true,
+		},
+	}
+	reverseProxy, err := proxy.New(targetServer.URL,
+		8097,
+		[]proxy.Masker{},
+		[]proxy.Blocker{},
+		zerolog.Nop())
+	require.NoError(t, err)
+	var out syncBuffer
+	reverseProxy.AccessLog = accesslog.New(accesslog.FormatJSON,
+		[]string{accesslog.FieldStatus, accesslog.FieldBytes, accesslog.FieldBytesReceived}, zerolog.InfoLevel, &out)
+	cancel, err := reverseProxy.Start()
+	require.NoError(t, err)
+	waitListening(t, reverseProxy.Port)
+	defer cancel()
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			blocker := &MockBlocker{
+				fn: func() (bool, error) {
+					return tt.blocked, nil
+				},
+			}
+			require.NoError(t, reverseProxy.Reload(targetServer.URL,
+				[]proxy.Masker{masks.NewEmailMasker()}, []proxy.Blocker{blocker}, tt.opts...))
+			out.Reset()
+			conn, err := net.Dial("tcp", "localhost:8097")
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+				"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+				"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n"))
+			require.NoError(t, err)
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			require.NoError(t, err)
+			if tt.blocked {
+				// The handshake goes through the blockers, the target is never contacted
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+				return
+			}
+			require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+			assert.Equal(t, tt.extensions, <-extensions)
+			_, err = conn.Write(appendFrame(nil, wsFrame{0x81, "hello"}, true))
+			require.NoError(t, err)
+			var frames []wsFrame
+			for {
+				f, err := readFrame(br)
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				frames = append(frames, f)
+			}
+			assert.Equal(t, tt.expected, frames)
+			conn.Close()
+			assert.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+			assert.JSONEq(t, `{"level":"info","status":101,"bytes":`+strconv.Itoa(tt.sent)+`,"bytes_received":11,`+
+				`"message":"request received"}`, out.String())
+		})
+	}
+}
+
+// appendFrame appends f to b, masked with a zero key when sent by the client
+func appendFrame(b []byte, f wsFrame, masked bool) []byte {
+	b = append(b, f.head)
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	if n := len(f.payload); n < 126 {
+		b = append(b, maskBit|byte(n))
+	} else {
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	if masked {
+		b = append(b, 0, 0, 0, 0)
+	}
+	return append(b, f.payload...)
+}
+
+// readFrame reads a frame of at most 64KiB, a masked one when its key is zero
+func readFrame(r *bufio.Reader) (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+	n := int(header[1] & 0x7f)
+	if n == 126 {
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return wsFrame{}, err
+		}
+		n = int(binary.BigEndian.Uint16(length[:]))
+	}
+	if header[1]&0x80 != 0 {
+		n += 4
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return wsFrame{}, err
+	}
+	if header[1]&0x80 != 0 {
+		payload = payload[4:]
+	}
+	return wsFrame{header[0], string(payload)}, nil
+}